@@ -11,7 +11,8 @@ import (
 
 // isValidCredsMessage checks if 'msg' contains invalid credentials error message.
 // It returns whether the logs are free of invalid credentials errors and the error if it isn't.
-// error values can be errCredentialsMissingServerURL or errCredentialsMissingUsername.
+// error values can be errCredentialsMissingServerURL, errCredentialsMissingUsername
+// or errCredentialsMissingSecret.
 func isValidCredsMessage(msg string) error {
 	if credentials.IsCredentialsMissingServerURLMessage(msg) {
 		return credentials.NewErrCredentialsMissingServerURL()
@@ -21,6 +22,10 @@ func isValidCredsMessage(msg string) error {
 		return credentials.NewErrCredentialsMissingUsername()
 	}
 
+	if credentials.IsCredentialsMissingSecretMessage(msg) {
+		return credentials.NewErrCredentialsMissingSecret()
+	}
+
 	return nil
 }
 
@@ -0,0 +1,193 @@
+package credentials
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/docker/docker-credential-helpers/registryurl"
+)
+
+// AliasesEnv is the environment variable holding the registry aliases applied
+// by Serve. Its value is either the path of an aliases file, or the aliases
+// themselves as a comma separated list of "mirror=registry" pairs.
+const AliasesEnv = "DOCKER_CREDS_ALIASES"
+
+// Aliases maps a registry host, such as a mirror, or a glob pattern of
+// hosts, to the registry whose credentials it reuses. Hosts include the
+// port, if any.
+type Aliases map[string]string
+
+// ParseAliases reads aliases with one "mirror = registry" pair per line.
+// Empty lines and lines starting with '#' are ignored. Both sides accept a
+// host or a server URL, and the mirror also accepts a glob pattern of hosts,
+// with the syntax of path.Match, where '*' matches dots too:
+//
+//	# Reuse the Docker Hub credentials for the local mirror.
+//	mirror.example.com:5000 = https://index.docker.io/v1/
+//	# Share the credentials of the internal registry with its replicas.
+//	*.internal.corp = registry.internal.corp
+func ParseAliases(r io.Reader) (Aliases, error) {
+	aliases := Aliases{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := aliases.add(line); err != nil {
+			return nil, fmt.Errorf("aliases line %d: %v", n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return aliases, nil
+}
+
+func (a Aliases) add(pair string) error {
+	i := strings.Index(pair, "=")
+	if i < 0 {
+		return fmt.Errorf("invalid alias %q, expected mirror=registry", pair)
+	}
+	target := strings.TrimSpace(pair[i+1:])
+	mirror := strings.TrimSpace(pair[:i])
+	if isHostPattern(mirror) {
+		if _, err := path.Match(mirror, ""); err != nil || strings.Contains(mirror, "/") || target == "" {
+			return fmt.Errorf("invalid alias pattern %q, expected a host pattern such as *.example.com", pair)
+		}
+		a[mirror] = target
+		return nil
+	}
+	host, err := aliasHost(mirror)
+	if err != nil || target == "" {
+		return fmt.Errorf("invalid alias %q, expected mirror=registry", pair)
+	}
+	a[host] = target
+	return nil
+}
+
+// isHostPattern reports whether a mirror is a glob pattern of hosts.
+func isHostPattern(mirror string) bool {
+	return strings.ContainsAny(mirror, "*?[")
+}
+
+// target returns the registry aliased by a host. Hosts are matched exactly
+// first, then by the most specific pattern matching them, which is the one
+// with the most characters other than wildcards. Patterns as specific as
+// each other are tried in lexical order.
+func (a Aliases) target(host string) (string, bool) {
+	if target, ok := a[host]; ok {
+		return target, true
+	}
+	best, bestLiterals := "", -1
+	for pattern := range a {
+		if !isHostPattern(pattern) {
+			continue
+		}
+		if ok, _ := path.Match(pattern, host); !ok {
+			continue
+		}
+		literals := len(pattern) - strings.Count(pattern, "*") - strings.Count(pattern, "?")
+		if literals > bestLiterals || literals == bestLiterals && pattern < best {
+			best, bestLiterals = pattern, literals
+		}
+	}
+	if bestLiterals < 0 {
+		return "", false
+	}
+	return a[best], true
+}
+
+// aliasesFromEnv returns the aliases configured with AliasesEnv, or nil.
+func aliasesFromEnv() (Aliases, error) {
+	value := os.Getenv(AliasesEnv)
+	if value == "" {
+		return nil, nil
+	}
+	return loadAliases(AliasesEnv, value)
+}
+
+// loadAliases reads the path of an aliases file or a comma separated list of
+// pairs, as given by source.
+func loadAliases(source, value string) (Aliases, error) {
+	if !strings.Contains(value, "=") {
+		f, err := os.Open(value)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return ParseAliases(f)
+	}
+
+	aliases := Aliases{}
+	for _, pair := range strings.Split(value, ",") {
+		if err := aliases.add(pair); err != nil {
+			return nil, fmt.Errorf("%s: %v", source, err)
+		}
+	}
+	return aliases, nil
+}
+
+func aliasHost(serverURL string) (string, error) {
+	u, err := registryurl.Parse(serverURL)
+	if err != nil {
+		return "", err
+	}
+	return u.Host, nil
+}
+
+// aliasedHelper looks up the credentials of the aliased registry when a
+// mirror has no credentials of its own.
+type aliasedHelper struct {
+	decorator
+	aliases Aliases
+}
+
+// WithAliases returns a helper that falls back to the credentials of the
+// aliased registry when Get finds no credentials for an aliased host.
+// Credentials stored for the host itself always take precedence.
+func WithAliases(helper Helper, aliases Aliases) Helper {
+	return aliasedHelper{decorator: decorator{helper}, aliases: aliases}
+}
+
+func (h aliasedHelper) Get(serverURL string) (string, string, error) {
+	return getCredentials(h.GetWithMeta(serverURL))
+}
+
+func (h aliasedHelper) GetWithMeta(serverURL string) (*ExtendedCredentials, error) {
+	creds, err := GetWithMeta(h.Helper, serverURL)
+	if !IsErrCredentialsNotFound(err) {
+		return creds, err
+	}
+
+	host, hostErr := aliasHost(serverURL)
+	if hostErr != nil {
+		return nil, err
+	}
+	target, ok := h.aliases.target(host)
+	if !ok {
+		return nil, err
+	}
+	return GetWithMeta(h.Helper, target)
+}
+
+func (h aliasedHelper) ResolveBackend(serverURL string) (string, bool, error) {
+	name, found, err := Resolve(h.Helper, serverURL)
+	if err != nil || found {
+		return name, found, err
+	}
+
+	host, hostErr := aliasHost(serverURL)
+	if hostErr != nil {
+		return "", false, nil
+	}
+	target, ok := h.aliases.target(host)
+	if !ok {
+		return "", false, nil
+	}
+	return Resolve(h.Helper, target)
+}
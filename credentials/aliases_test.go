@@ -0,0 +1,125 @@
+package credentials
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseAliases(t *testing.T) {
+	aliases, err := ParseAliases(strings.NewReader(`
+# Docker Hub mirror
+mirror.example.com:5000 = https://index.docker.io/v1/
+https://other-mirror.example.com/v2/=registry.example.com
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if aliases["mirror.example.com:5000"] != "https://index.docker.io/v1/" {
+		t.Fatalf("unexpected alias for mirror.example.com:5000: %q", aliases["mirror.example.com:5000"])
+	}
+	if aliases["other-mirror.example.com"] != "registry.example.com" {
+		t.Fatalf("unexpected alias for other-mirror.example.com: %q", aliases["other-mirror.example.com"])
+	}
+
+	if _, err := ParseAliases(strings.NewReader("mirror.example.com\n")); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Fatalf("expected an invalid alias error, got %v", err)
+	}
+}
+
+func TestWithAliases(t *testing.T) {
+	store := newMemoryStore()
+	store.Add(&Credentials{ServerURL: "https://index.docker.io/v1/", Username: "hub", Secret: "hubsecret"})
+	store.Add(&Credentials{ServerURL: "other-mirror.example.com", Username: "own", Secret: "ownsecret"})
+
+	h := WithAliases(store, Aliases{
+		"mirror.example.com:5000":  "https://index.docker.io/v1/",
+		"other-mirror.example.com": "https://index.docker.io/v1/",
+	})
+
+	username, secret, err := h.Get("https://mirror.example.com:5000/v2/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if username != "hub" || secret != "hubsecret" {
+		t.Fatalf("expected the aliased credentials, got %s:%s", username, secret)
+	}
+
+	username, _, err = h.Get("other-mirror.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if username != "own" {
+		t.Fatalf("expected the mirror's own credentials to take precedence, got %s", username)
+	}
+
+	if _, _, err := h.Get("unknown.example.com"); !IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestAliasesFromEnv(t *testing.T) {
+	defer os.Setenv(AliasesEnv, os.Getenv(AliasesEnv))
+
+	os.Setenv(AliasesEnv, "mirror.example.com=registry.example.com,mirror2.example.com=registry.example.com")
+	aliases, err := aliasesFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aliases) != 2 || aliases["mirror2.example.com"] != "registry.example.com" {
+		t.Fatalf("unexpected aliases %v", aliases)
+	}
+
+	os.Setenv(AliasesEnv, "")
+	if aliases, err := aliasesFromEnv(); aliases != nil || err != nil {
+		t.Fatalf("expected no aliases, got %v, %v", aliases, err)
+	}
+}
+
+func TestAliasPatterns(t *testing.T) {
+	aliases, err := ParseAliases(strings.NewReader(`
+*.corp = https://corp.example.com
+*.internal.corp = internal-registry.corp
+eu-*.internal.corp = eu-registry.corp
+b.internal.corp = b-registry.corp
+a?.internal.corp = a-registry.corp
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		host   string
+		target string
+	}{
+		{host: "build.corp", target: "https://corp.example.com"},
+		{host: "ci.internal.corp", target: "internal-registry.corp"},
+		{host: "eu-west.internal.corp", target: "eu-registry.corp"},
+		{host: "b.internal.corp", target: "b-registry.corp"},
+		{host: "a1.internal.corp", target: "a-registry.corp"},
+		{host: "ci.internal.corp:5000", target: ""},
+		{host: "example.com", target: ""},
+	}
+	for _, te := range tests {
+		target, ok := aliases.target(te.host)
+		if ok != (te.target != "") || target != te.target {
+			t.Errorf("expected %s to alias %q, got %q", te.host, te.target, target)
+		}
+	}
+
+	store := newMemoryStore()
+	store.Add(&Credentials{ServerURL: "internal-registry.corp", Username: "internal", Secret: "secret"})
+	store.Add(&Credentials{ServerURL: "own.internal.corp", Username: "own", Secret: "secret"})
+	h := WithAliases(store, aliases)
+	if username, _, err := h.Get("https://ci.internal.corp"); err != nil || username != "internal" {
+		t.Fatalf("expected the credentials of the pattern target, got %s, %v", username, err)
+	}
+	if username, _, err := h.Get("own.internal.corp"); err != nil || username != "own" {
+		t.Fatalf("expected the own credentials of the host to take precedence, got %s, %v", username, err)
+	}
+
+	if _, err := ParseAliases(strings.NewReader("[a-.corp = registry.corp")); err == nil {
+		t.Fatal("expected an invalid pattern to be rejected")
+	}
+}
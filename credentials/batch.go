@@ -0,0 +1,53 @@
+package credentials
+
+import (
+	"fmt"
+	"sync"
+)
+
+// BatchConcurrency is the number of lookups GetBatch runs at once.
+var BatchConcurrency = 4
+
+// GetBatch returns the credentials of several server URLs, looked up with
+// up to BatchConcurrency concurrent calls to Get, so helpers must be safe for
+// concurrent use. A failed lookup does not abort the others: the credentials
+// found are returned by server URL, and the errors of the other lookups,
+// including credentials not found, are returned prefixed with their server
+// URL, in the order of the server URLs.
+func GetBatch(helper Helper, serverURLs []string) (map[string]Credentials, []error) {
+	results := make([]Credentials, len(serverURLs))
+	errs := make([]error, len(serverURLs))
+
+	concurrency := BatchConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, serverURL := range serverURLs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, serverURL string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			username, secret, err := helper.Get(serverURL)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", serverURL, err)
+				return
+			}
+			results[i] = Credentials{ServerURL: serverURL, Username: username, Secret: secret}
+		}(i, serverURL)
+	}
+	wg.Wait()
+
+	found := map[string]Credentials{}
+	var failed []error
+	for i, serverURL := range serverURLs {
+		if errs[i] != nil {
+			failed = append(failed, errs[i])
+			continue
+		}
+		found[serverURL] = results[i]
+	}
+	return found, failed
+}
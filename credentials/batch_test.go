@@ -0,0 +1,65 @@
+package credentials
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// concurrentStore is a read-only store safe for concurrent use, recording
+// the highest number of concurrent lookups.
+type concurrentStore struct {
+	*memoryStore
+	mu      sync.Mutex
+	running int
+	max     int
+}
+
+func (c *concurrentStore) Get(serverURL string) (string, string, error) {
+	c.mu.Lock()
+	c.running++
+	if c.running > c.max {
+		c.max = c.running
+	}
+	c.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	defer func() {
+		c.mu.Lock()
+		c.running--
+		c.mu.Unlock()
+	}()
+
+	if serverURL == "https://broken.example.com" {
+		return "", "", errors.New("backend failure")
+	}
+	return c.memoryStore.Get(serverURL)
+}
+
+func TestGetBatch(t *testing.T) {
+	store := &concurrentStore{memoryStore: newMemoryStore()}
+	store.memoryStore.Add(&Credentials{ServerURL: "https://index.docker.io/v1/", Username: "foo", Secret: "bar"})
+	store.memoryStore.Add(&Credentials{ServerURL: "https://quay.io", Username: "baz", Secret: "qux"})
+
+	serverURLs := []string{"https://index.docker.io/v1/", "https://gcr.io", "https://quay.io", "https://broken.example.com"}
+	for i := 0; i < 3; i++ {
+		serverURLs = append(serverURLs, "https://quay.io")
+	}
+	found, errs := GetBatch(store, serverURLs)
+
+	if len(found) != 2 || found["https://index.docker.io/v1/"].Secret != "bar" || found["https://quay.io"].Username != "baz" {
+		t.Fatalf("unexpected credentials %v", found)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("expected two errors, got %v", errs)
+	}
+	if !IsErrCredentialsNotFound(errs[0]) || errs[0].Error() != "https://gcr.io: credentials not found in native keychain" {
+		t.Fatalf("expected the miss first, got %v", errs[0])
+	}
+	if errs[1].Error() != "https://broken.example.com: backend failure" {
+		t.Fatalf("expected the failure second, got %v", errs[1])
+	}
+	if store.max > BatchConcurrency {
+		t.Fatalf("expected at most %d concurrent lookups, got %d", BatchConcurrency, store.max)
+	}
+}
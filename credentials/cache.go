@@ -0,0 +1,137 @@
+package credentials
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// CacheTTLEnv is the environment variable enabling the cache of Serve. Its
+// value is the time to live of the cached credentials, such as "30s".
+const CacheTTLEnv = "DOCKER_CREDS_CACHE_TTL"
+
+type cacheEntry struct {
+	creds   ExtendedCredentials
+	expires time.Time
+}
+
+// cachedHelper serves repeated lookups from memory.
+type cachedHelper struct {
+	decorator
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	// generation counts the invalidations, so that a lookup racing with a
+	// store or an erase does not cache what it read before the write. A
+	// write may change the credentials of any server URL, through aliases
+	// and wildcards, so it ends the generation of every server URL.
+	generation uint64
+}
+
+// WithCache returns a helper keeping the credentials returned by Get in
+// memory for ttl, so that bursts of lookups for the same server URL only
+// reach the store once. Storing or erasing credentials empties the cache,
+// since aliases and wildcards let an entry serve other server URLs.
+//
+// The cache lives as long as the process, which is only useful to programs
+// serving several requests, such as a Serve kept alive by its caller or
+// ServeCache. Cached secrets stay in memory until they expire.
+func WithCache(helper Helper, ttl time.Duration) Helper {
+	return &cachedHelper{decorator: decorator{helper}, ttl: ttl, now: time.Now, entries: map[string]cacheEntry{}}
+}
+
+func (h *cachedHelper) invalidate() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = map[string]cacheEntry{}
+	h.generation++
+}
+
+// copyCredentials returns a copy of credentials which shares no metadata
+// with them, so that callers cannot alter the cached credentials.
+func copyCredentials(creds ExtendedCredentials) *ExtendedCredentials {
+	if creds.Metadata != nil {
+		metadata := make(map[string]string, len(creds.Metadata))
+		for k, v := range creds.Metadata {
+			metadata[k] = v
+		}
+		creds.Metadata = metadata
+	}
+	return &creds
+}
+
+func (h *cachedHelper) Add(creds *Credentials) error {
+	defer h.invalidate()
+	return h.Helper.Add(creds)
+}
+
+func (h *cachedHelper) AddWithMeta(creds *ExtendedCredentials) error {
+	defer h.invalidate()
+	return AddWithMeta(h.Helper, creds)
+}
+
+func (h *cachedHelper) Delete(serverURL string) error {
+	defer h.invalidate()
+	return h.Helper.Delete(serverURL)
+}
+
+func (h *cachedHelper) Get(serverURL string) (string, string, error) {
+	return getCredentials(h.GetWithMeta(serverURL))
+}
+
+func (h *cachedHelper) GetWithMeta(serverURL string) (*ExtendedCredentials, error) {
+	h.mu.Lock()
+	entry, ok := h.entries[serverURL]
+	generation := h.generation
+	h.mu.Unlock()
+	if ok && h.now().Before(entry.expires) {
+		return copyCredentials(entry.creds), nil
+	}
+
+	creds, err := GetWithMeta(h.Helper, serverURL)
+	if err != nil {
+		return nil, err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// A store or an erase ran during the lookup, which may have read the
+	// credentials it replaced.
+	if h.generation != generation {
+		return creds, nil
+	}
+	h.entries[serverURL] = cacheEntry{creds: *copyCredentials(*creds), expires: h.now().Add(h.ttl)}
+	return creds, nil
+}
+
+// Prefetch fills the cache with the credentials of every listed server URL.
+func (h *cachedHelper) Prefetch() error {
+	if err := Prefetch(h.Helper); err != nil {
+		return err
+	}
+	accts, err := h.Helper.List()
+	if err != nil {
+		return err
+	}
+	for serverURL := range accts {
+		if _, err := h.GetWithMeta(serverURL); err != nil && !IsErrCredentialsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// cacheTTLFromEnv returns the TTL configured with CacheTTLEnv, or zero.
+func cacheTTLFromEnv() (time.Duration, error) {
+	value := os.Getenv(CacheTTLEnv)
+	if value == "" {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl < 0 {
+		return 0, fmt.Errorf("invalid %s %q, expected a duration such as 30s", CacheTTLEnv, value)
+	}
+	return ttl, nil
+}
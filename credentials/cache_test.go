@@ -0,0 +1,165 @@
+package credentials
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// countingStore counts the lookups reaching a memoryStore.
+type countingStore struct {
+	*memoryStore
+	lookups int
+}
+
+func (c *countingStore) Get(serverURL string) (string, string, error) {
+	c.lookups++
+	return c.memoryStore.Get(serverURL)
+}
+
+func TestWithCache(t *testing.T) {
+	serverURL := "https://index.docker.io/v1/"
+	store := &countingStore{memoryStore: newMemoryStore()}
+	store.Add(&Credentials{ServerURL: serverURL, Username: "foo", Secret: "bar"})
+
+	now := time.Unix(0, 0)
+	h := WithCache(store, time.Minute)
+	h.(*cachedHelper).now = func() time.Time { return now }
+
+	get := func(expected string) {
+		t.Helper()
+		_, secret, err := h.Get(serverURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secret != expected {
+			t.Fatalf("expected secret %s, got %s", expected, secret)
+		}
+	}
+
+	get("bar")
+	get("bar")
+	if store.lookups != 1 {
+		t.Fatalf("expected the second get to hit the cache, got %d lookups", store.lookups)
+	}
+
+	// Entries expire after their TTL.
+	now = now.Add(time.Minute)
+	get("bar")
+	if store.lookups != 2 {
+		t.Fatalf("expected the expired entry to be looked up again, got %d lookups", store.lookups)
+	}
+
+	// Storing credentials invalidates the cache.
+	if err := h.Add(&Credentials{ServerURL: serverURL, Username: "foo", Secret: "updated"}); err != nil {
+		t.Fatal(err)
+	}
+	get("updated")
+	if store.lookups != 3 {
+		t.Fatalf("expected the store to invalidate the cache, got %d lookups", store.lookups)
+	}
+
+	// So does erasing them.
+	if err := h.Delete(serverURL); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := h.Get(serverURL); !IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected not found after erase, got %v", err)
+	}
+
+	// Misses are not cached.
+	store.Add(&Credentials{ServerURL: serverURL, Username: "foo", Secret: "bar"})
+	get("bar")
+}
+
+func TestWithCachePrefetch(t *testing.T) {
+	store := &countingStore{memoryStore: newMemoryStore()}
+	store.Add(&Credentials{ServerURL: "https://index.docker.io/v1/", Username: "foo", Secret: "bar"})
+	store.Add(&Credentials{ServerURL: "https://quay.io", Username: "foo", Secret: "bar"})
+
+	h := WithCache(store, time.Minute)
+	if err := Prefetch(h); err != nil {
+		t.Fatal(err)
+	}
+	lookups := store.lookups
+	for _, serverURL := range []string{"https://index.docker.io/v1/", "https://quay.io"} {
+		if _, _, err := h.Get(serverURL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if store.lookups != lookups {
+		t.Fatalf("expected gets to be served from the prefetched cache, got %d lookups", store.lookups-lookups)
+	}
+}
+
+// racingStore runs a write while a lookup reads the old credentials.
+type racingStore struct {
+	*metadataStore
+	during func()
+}
+
+func (r *racingStore) GetWithMeta(serverURL string) (*ExtendedCredentials, error) {
+	creds, err := r.metadataStore.GetWithMeta(serverURL)
+	if r.during != nil {
+		during := r.during
+		r.during = nil
+		during()
+	}
+	return creds, err
+}
+
+func TestWithCacheRacingWrite(t *testing.T) {
+	serverURL := "https://index.docker.io/v1/"
+	store := &racingStore{metadataStore: newMetadataStore()}
+	store.Add(&Credentials{ServerURL: serverURL, Username: "foo", Secret: "old"})
+	h := WithCache(store, time.Hour)
+
+	store.during = func() {
+		h.Add(&Credentials{ServerURL: serverURL, Username: "foo", Secret: "new"})
+	}
+	if _, secret, err := h.Get(serverURL); err != nil || secret != "old" {
+		t.Fatalf("expected the lookup to return what it read, got %s, %v", secret, err)
+	}
+	if _, secret, err := h.Get(serverURL); err != nil || secret != "new" {
+		t.Fatalf("expected the credentials read before the write not to be cached, got %s, %v", secret, err)
+	}
+}
+
+func TestWithCacheMetadataCopy(t *testing.T) {
+	serverURL := "https://index.docker.io/v1/"
+	store := newMetadataStore()
+	store.AddWithMeta(&ExtendedCredentials{
+		Credentials: Credentials{ServerURL: serverURL, Username: "foo", Secret: "bar"},
+		Metadata:    map[string]string{"scope": "read"},
+	})
+	h := WithCache(store, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		creds, err := GetWithMeta(h, serverURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if creds.Metadata["scope"] != "read" {
+			t.Fatalf("expected the cached metadata to be unchanged, got %v", creds.Metadata)
+		}
+		creds.Metadata["scope"] = "write"
+	}
+}
+
+func TestCacheTTLFromEnv(t *testing.T) {
+	defer os.Setenv(CacheTTLEnv, os.Getenv(CacheTTLEnv))
+
+	os.Setenv(CacheTTLEnv, "30s")
+	h, err := configure(newMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, ok := h.(*cachedHelper); !ok || c.ttl != 30*time.Second {
+		t.Fatalf("expected a 30s cache, got %#v", h)
+	}
+
+	os.Setenv(CacheTTLEnv, "soon")
+	if _, err := configure(newMemoryStore()); err == nil {
+		t.Fatal("expected an invalid TTL to be rejected")
+	}
+}
@@ -0,0 +1,221 @@
+package credentials
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheRequest is a request sent to a cache server: the action of a helper
+// and the payload it reads from its standard input.
+type cacheRequest struct {
+	Action  string
+	Payload string
+}
+
+// cacheResponse is the answer of a cache server: the output of the action,
+// or its error.
+type cacheResponse struct {
+	Output string
+	Error  string `json:",omitempty"`
+}
+
+// cacheDeadline bounds the time a cache server spends on a connection.
+const cacheDeadline = time.Minute
+
+// ServeCache serves the actions of a helper to the CacheClient connecting to
+// the listener, keeping the credentials returned by get in memory for ttl,
+// like docker-credential-cache. Each credential expires ttl after it was
+// read from the helper, and is then read from it again. Storing or erasing
+// credentials goes through to the helper and empties the cache, so that an
+// erased credential is never served again.
+//
+// Only the store, get, erase, list and prefetch actions are served. The
+// server does not authenticate its clients, so any process able to connect
+// can read every credential: the listener must be a unix socket sitting in a
+// directory only accessible by its owner, with 0700 permissions, and
+// ServeCache refuses to serve other listeners, except on Windows.
+//
+// It serves until the listener is closed, and returns the error of Accept.
+// Actions are run one at a time, so the helper needs not be safe for
+// concurrent use.
+func ServeCache(l net.Listener, helper Helper, ttl time.Duration) error {
+	if err := checkSocketDir(l); err != nil {
+		return err
+	}
+	return serveCache(l, WithCache(helper, ttl))
+}
+
+// cacheActions are the actions served by a cache server. Actions such as
+// netrc or verify would hand every secret to any client of the socket.
+var cacheActions = map[string]bool{
+	"store":    true,
+	"get":      true,
+	"erase":    true,
+	"list":     true,
+	"prefetch": true,
+}
+
+// checkSocketDir checks that a listener is a unix socket sitting in a
+// directory only accessible by its owner. Windows has no such permissions.
+func checkSocketDir(l net.Listener) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	addr, ok := l.Addr().(*net.UnixAddr)
+	if !ok {
+		return fmt.Errorf("credentials cache: %s listeners cannot be protected, use a unix socket in a 0700 directory", l.Addr().Network())
+	}
+	if strings.HasPrefix(addr.Name, "@") || addr.Name == "" {
+		return errors.New("credentials cache: abstract unix sockets cannot be protected, use a socket in a 0700 directory")
+	}
+	dir := filepath.Dir(addr.Name)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("credentials cache: %v", err)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("credentials cache: the directory %s of the socket must only be accessible by its owner, with 0700 permissions, got %04o", dir, info.Mode().Perm())
+	}
+	return nil
+}
+
+func serveCache(l net.Listener, helper Helper) error {
+	var mu sync.Mutex
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(cacheDeadline))
+
+			var req cacheRequest
+			if err := json.NewDecoder(conn).Decode(&req); err != nil {
+				json.NewEncoder(conn).Encode(cacheResponse{Error: fmt.Sprintf("invalid cache request: %v", err)})
+				return
+			}
+
+			out := new(bytes.Buffer)
+			payload := []byte(req.Payload)
+			mu.Lock()
+			var err error
+			if cacheActions[req.Action] {
+				err = HandleCommand(helper, req.Action, bytes.NewReader(payload), out)
+			} else {
+				err = fmt.Errorf("unsupported operation: %s", req.Action)
+			}
+			mu.Unlock()
+			zero(payload)
+
+			resp := cacheResponse{Output: out.String()}
+			if err != nil {
+				resp.Error = err.Error()
+			}
+			zero(out.Bytes())
+			json.NewEncoder(conn).Encode(resp)
+		}()
+	}
+}
+
+// CacheClient is a helper reading and writing credentials through the cache
+// server listening on Address, such as the path of a unix socket, started
+// with ServeCache.
+type CacheClient struct {
+	Network string
+	Address string
+}
+
+// do runs an action on the cache server.
+func (c CacheClient) do(action, payload string) (string, error) {
+	conn, err := net.DialTimeout(c.Network, c.Address, 10*time.Second)
+	if err != nil {
+		return "", NewBackendError(ErrBackendUnavailable, fmt.Errorf("credentials cache: %v", err))
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(cacheDeadline))
+
+	if err := json.NewEncoder(conn).Encode(cacheRequest{Action: action, Payload: payload}); err != nil {
+		return "", NewBackendError(ErrBackendUnavailable, fmt.Errorf("credentials cache: %v", err))
+	}
+	var resp cacheResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return "", NewBackendError(ErrBackendUnavailable, fmt.Errorf("credentials cache: %v", err))
+	}
+	if resp.Error != "" {
+		switch msg := resp.Error; {
+		case IsErrCredentialsNotFoundMessage(msg):
+			return "", NewErrCredentialsNotFound()
+		case IsCredentialsMissingServerURLMessage(msg):
+			return "", NewErrCredentialsMissingServerURL()
+		case IsCredentialsMissingUsernameMessage(msg):
+			return "", NewErrCredentialsMissingUsername()
+		case IsCredentialsMissingSecretMessage(msg):
+			return "", NewErrCredentialsMissingSecret()
+		}
+		return "", errors.New(resp.Error)
+	}
+	return resp.Output, nil
+}
+
+// Add stores credentials through the cache server.
+func (c CacheClient) Add(creds *Credentials) error {
+	if creds == nil {
+		return errors.New("missing credentials")
+	}
+	payload, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+	_, err = c.do("store", string(payload))
+	return err
+}
+
+// Delete erases credentials through the cache server.
+func (c CacheClient) Delete(serverURL string) error {
+	_, err := c.do("erase", serverURL)
+	return err
+}
+
+// Get returns the credentials of a server URL, from the cache of the cache
+// server if they have not expired.
+func (c CacheClient) Get(serverURL string) (string, string, error) {
+	out, err := c.do("get", serverURL)
+	if err != nil {
+		return "", "", err
+	}
+	var creds Credentials
+	if err := json.NewDecoder(strings.NewReader(out)).Decode(&creds); err != nil {
+		return "", "", fmt.Errorf("credentials cache: invalid response: %v", err)
+	}
+	return creds.Username, creds.Secret, nil
+}
+
+// Prefetch fills the cache of the cache server with the credentials of every
+// server URL listed by its helper.
+func (c CacheClient) Prefetch() error {
+	_, err := c.do("prefetch", "")
+	return err
+}
+
+// List returns the credentials listed by the helper of the cache server.
+func (c CacheClient) List() (map[string]string, error) {
+	out, err := c.do("list", "")
+	if err != nil {
+		return nil, err
+	}
+	var accts map[string]string
+	if err := json.NewDecoder(strings.NewReader(out)).Decode(&accts); err != nil {
+		return nil, fmt.Errorf("credentials cache: invalid response: %v", err)
+	}
+	return accts, nil
+}
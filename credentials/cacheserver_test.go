@@ -0,0 +1,175 @@
+package credentials
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startCacheServer(t *testing.T, helper Helper) (CacheClient, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go serveCache(l, helper)
+	return CacheClient{Network: "tcp", Address: l.Addr().String()}, func() { l.Close() }
+}
+
+func TestCacheServerExpiry(t *testing.T) {
+	serverURL := "https://index.docker.io/v1/"
+	store := &countingStore{memoryStore: newMemoryStore()}
+	store.Add(&Credentials{ServerURL: serverURL, Username: "foo", Secret: "bar"})
+
+	now := time.Unix(0, 0)
+	cached := WithCache(store, time.Minute).(*cachedHelper)
+	cached.now = func() time.Time { return now }
+	client, stop := startCacheServer(t, cached)
+	defer stop()
+
+	for i := 0; i < 3; i++ {
+		username, secret, err := client.Get(serverURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if username != "foo" || secret != "bar" {
+			t.Fatalf("unexpected credentials %s:%s", username, secret)
+		}
+	}
+	if store.lookups != 1 {
+		t.Fatalf("expected the credentials to be served from the cache, got %d lookups", store.lookups)
+	}
+
+	now = now.Add(time.Minute)
+	if _, _, err := client.Get(serverURL); err != nil {
+		t.Fatal(err)
+	}
+	if store.lookups != 2 {
+		t.Fatalf("expected the expired credentials to be read again, got %d lookups", store.lookups)
+	}
+}
+
+func TestCacheServerPrefetch(t *testing.T) {
+	store := &countingStore{memoryStore: newMemoryStore()}
+	store.Add(&Credentials{ServerURL: "https://index.docker.io/v1/", Username: "foo", Secret: "bar"})
+	store.Add(&Credentials{ServerURL: "https://quay.io", Username: "foo", Secret: "bar"})
+	client, stop := startCacheServer(t, WithCache(store, time.Minute))
+	defer stop()
+
+	if err := Prefetch(client); err != nil {
+		t.Fatal(err)
+	}
+	lookups := store.lookups
+	for _, serverURL := range []string{"https://index.docker.io/v1/", "https://quay.io"} {
+		if _, _, err := client.Get(serverURL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if store.lookups != lookups {
+		t.Fatalf("expected gets to be served from the prefetched cache, got %d lookups", store.lookups-lookups)
+	}
+}
+
+func TestCacheServerErase(t *testing.T) {
+	serverURL := "https://index.docker.io/v1/"
+	store := newMemoryStore()
+	client, stop := startCacheServer(t, WithCache(store, time.Hour))
+	defer stop()
+
+	if err := client.Add(&Credentials{ServerURL: serverURL, Username: "foo", Secret: "bar"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := client.Get(serverURL); err != nil {
+		t.Fatal(err)
+	}
+	list, err := client.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[serverURL] != "foo" {
+		t.Fatalf("unexpected list result: %v", list)
+	}
+
+	if err := client.Delete(serverURL); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.creds) != 0 {
+		t.Fatalf("expected the credentials to be erased from the helper, got %v", store.creds)
+	}
+	if _, _, err := client.Get(serverURL); !IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected erased credentials not to be served from the cache, got %v", err)
+	}
+	if err := client.Add(&Credentials{ServerURL: serverURL, Secret: "bar"}); !IsCredentialsMissingUsername(err) {
+		t.Fatalf("expected a missing username error, got %v", err)
+	}
+}
+
+func TestCacheClientUnavailable(t *testing.T) {
+	client, stop := startCacheServer(t, newMemoryStore())
+	stop()
+	if _, _, err := client.Get("https://index.docker.io/v1/"); !errors.Is(err, ErrBackendUnavailable) {
+		t.Fatalf("expected a backend unavailable error, got %v", err)
+	}
+}
+
+func TestCacheServerActions(t *testing.T) {
+	store := newMemoryStore()
+	store.Add(&Credentials{ServerURL: "https://index.docker.io/v1/", Username: "foo", Secret: "bar"})
+	client, stop := startCacheServer(t, store)
+	defer stop()
+
+	for _, action := range []string{"netrc", "verify", "check", "resolve"} {
+		out, err := client.do(action, "https://index.docker.io/v1/")
+		if err == nil || err.Error() != "unsupported operation: "+action {
+			t.Fatalf("expected %s to be refused, got %v", action, err)
+		}
+		if strings.Contains(out, "bar") {
+			t.Fatalf("expected %s not to reveal the secret, got %q", action, out)
+		}
+	}
+}
+
+func TestServeCacheSocketDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix permissions are not enforced on Windows")
+	}
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := net.Listen("unix", filepath.Join(dir, "socket"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	os.Chmod(dir, 0755)
+	if err := ServeCache(l, newMemoryStore(), time.Minute); err == nil || !strings.Contains(err.Error(), "0700") {
+		t.Fatalf("expected a socket in a shared directory to be refused, got %v", err)
+	}
+
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+	if err := ServeCache(tcp, newMemoryStore(), time.Minute); err == nil || !strings.Contains(err.Error(), "unix socket") {
+		t.Fatalf("expected a tcp listener to be refused, got %v", err)
+	}
+
+	os.Chmod(dir, 0700)
+	done := make(chan error)
+	go func() { done <- ServeCache(l, newMemoryStore(), time.Minute) }()
+	client := CacheClient{Network: "unix", Address: l.Addr().String()}
+	if _, err := client.List(); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	<-done
+}
@@ -0,0 +1,154 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+)
+
+// BackendResolver is implemented by helpers which can tell which backend
+// serves the credentials of a server URL.
+type BackendResolver interface {
+	// ResolveBackend returns the name of the backend holding the credentials
+	// of a server URL, and whether there is one.
+	ResolveBackend(serverURL string) (string, bool, error)
+}
+
+// Resolve reports the name of the backend which would serve the credentials
+// of a server URL, and whether any would, without returning the credentials.
+// Helpers which do not implement BackendResolver have no name, so only
+// report whether they hold the credentials.
+func Resolve(helper Helper, serverURL string) (string, bool, error) {
+	if r, ok := helper.(BackendResolver); ok {
+		return r.ResolveBackend(serverURL)
+	}
+	_, _, err := helper.Get(serverURL)
+	if IsErrCredentialsNotFound(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return "", true, nil
+}
+
+// namedHelper is a helper reporting the name of its backend.
+type namedHelper struct {
+	decorator
+	name string
+}
+
+// Named returns a helper reporting name as the backend serving the
+// credentials it holds.
+func Named(name string, helper Helper) Helper {
+	return namedHelper{decorator: decorator{helper}, name: name}
+}
+
+func (h namedHelper) ResolveBackend(serverURL string) (string, bool, error) {
+	_, found, err := Resolve(h.Helper, serverURL)
+	if err != nil || !found {
+		return "", found, err
+	}
+	return h.name, true, nil
+}
+
+func (h namedHelper) Check() error {
+	if err := Check(h.Helper); err != nil {
+		return fmt.Errorf("%s: %w", h.name, err)
+	}
+	return nil
+}
+
+// chain looks up credentials in several helpers.
+type chain []Helper
+
+// Chain returns a helper looking up credentials in each of the helpers, in
+// order. Get returns the credentials of the first helper holding some, and
+// List the entries of all the helpers, the first helper winning when several
+// hold the same server URL. Add and Delete only apply to the first helper.
+// Helpers created with Named are reported by Resolve.
+func Chain(helpers ...Helper) Helper {
+	return chain(helpers)
+}
+
+var errEmptyChain = errors.New("no credentials helper in the chain")
+
+func (c chain) Add(creds *Credentials) error {
+	if len(c) == 0 {
+		return errEmptyChain
+	}
+	return c[0].Add(creds)
+}
+
+func (c chain) AddWithMeta(creds *ExtendedCredentials) error {
+	if len(c) == 0 {
+		return errEmptyChain
+	}
+	return AddWithMeta(c[0], creds)
+}
+
+func (c chain) Delete(serverURL string) error {
+	if len(c) == 0 {
+		return errEmptyChain
+	}
+	return c[0].Delete(serverURL)
+}
+
+func (c chain) Get(serverURL string) (string, string, error) {
+	return getCredentials(c.GetWithMeta(serverURL))
+}
+
+func (c chain) GetWithMeta(serverURL string) (*ExtendedCredentials, error) {
+	for _, h := range c {
+		creds, err := GetWithMeta(h, serverURL)
+		if !IsErrCredentialsNotFound(err) {
+			return creds, err
+		}
+	}
+	return nil, NewErrCredentialsNotFound()
+}
+
+func (c chain) List() (map[string]string, error) {
+	resp := map[string]string{}
+	for i := len(c) - 1; i >= 0; i-- {
+		accts, err := c[i].List()
+		if err != nil {
+			return nil, err
+		}
+		for serverURL, username := range accts {
+			resp[serverURL] = username
+		}
+	}
+	return resp, nil
+}
+
+func (c chain) ResolveBackend(serverURL string) (string, bool, error) {
+	for _, h := range c {
+		name, found, err := Resolve(h, serverURL)
+		if err != nil || found {
+			return name, found, err
+		}
+	}
+	return "", false, nil
+}
+
+func (c chain) Prefetch() error {
+	for _, h := range c {
+		if err := Prefetch(h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check checks every helper of the chain, since Get may reach any of them.
+func (c chain) Check() error {
+	if len(c) == 0 {
+		return errEmptyChain
+	}
+	for _, h := range c {
+		if err := Check(h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
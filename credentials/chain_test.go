@@ -0,0 +1,125 @@
+package credentials
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	primary, secondary := newMemoryStore(), newMemoryStore()
+	secondary.Add(&Credentials{ServerURL: "https://quay.io", Username: "secondary", Secret: "bar"})
+	secondary.Add(&Credentials{ServerURL: "https://index.docker.io/v1/", Username: "secondary", Secret: "bar"})
+	h := Chain(Named("primary", primary), Named("secondary", secondary))
+
+	if err := h.Add(&Credentials{ServerURL: "https://index.docker.io/v1/", Username: "primary", Secret: "foo"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := primary.creds["https://index.docker.io/v1/"]; !ok {
+		t.Fatal("expected the credentials to be added to the first helper")
+	}
+
+	username, _, err := h.Get("https://index.docker.io/v1/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if username != "primary" {
+		t.Fatalf("expected the first helper to take precedence, got %s", username)
+	}
+	if username, _, err = h.Get("https://quay.io"); err != nil || username != "secondary" {
+		t.Fatalf("expected the credentials of the second helper, got %s, %v", username, err)
+	}
+	if _, _, err := h.Get("https://gcr.io"); !IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	list, err := h.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list["https://index.docker.io/v1/"] != "primary" || list["https://quay.io"] != "secondary" {
+		t.Fatalf("unexpected list %v", list)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	primary, secondary := newMemoryStore(), newMemoryStore()
+	primary.Add(&Credentials{ServerURL: "https://index.docker.io/v1/", Username: "foo", Secret: "bar"})
+	secondary.Add(&Credentials{ServerURL: "https://quay.io", Username: "foo", Secret: "bar"})
+	h := Chain(Named("primary", primary), Named("secondary", secondary))
+
+	tests := []struct {
+		helper    Helper
+		serverURL string
+		backend   string
+		found     bool
+	}{
+		{h, "https://quay.io", "secondary", true},
+		{h, "https://index.docker.io/v1/", "primary", true},
+		{h, "https://gcr.io", "", false},
+		{WithAliases(h, Aliases{"mirror.example.com": "https://quay.io"}), "https://mirror.example.com", "secondary", true},
+		{WithWildcards(Chain(primary, Named("secondary", secondary))), "https://registry.quay.io", "", false},
+		{primary, "https://index.docker.io/v1/", "", true},
+	}
+	for _, te := range tests {
+		backend, found, err := Resolve(te.helper, te.serverURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if backend != te.backend || found != te.found {
+			t.Fatalf("%s: expected %q, %v, got %q, %v", te.serverURL, te.backend, te.found, backend, found)
+		}
+	}
+
+	secondary.Add(&Credentials{ServerURL: "https://*.example.com", Username: "foo", Secret: "bar"})
+	backend, found, err := Resolve(WithWildcards(h), "https://registry.example.com")
+	if err != nil || !found || backend != "secondary" {
+		t.Fatalf("expected the wildcard of the second helper, got %q, %v, %v", backend, found, err)
+	}
+}
+
+func TestPrintResolve(t *testing.T) {
+	secondary := newMemoryStore()
+	secondary.Add(&Credentials{ServerURL: "https://quay.io", Username: "foo", Secret: "bar"})
+	h := Chain(Named("primary", newMemoryStore()), Named("secondary", secondary))
+
+	w := new(bytes.Buffer)
+	if err := HandleCommand(h, "resolve", strings.NewReader("https://quay.io\n"), w); err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"ServerURL":"https://quay.io","Backend":"secondary","Found":true}` + "\n"; w.String() != expected {
+		t.Fatalf("expected %s, got %s", expected, w.String())
+	}
+	if strings.Contains(w.String(), "bar") {
+		t.Fatal("expected the secret not to be written")
+	}
+
+	w.Reset()
+	if err := HandleCommand(h, "resolve", strings.NewReader("https://gcr.io"), w); err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"ServerURL":"https://gcr.io","Found":false}` + "\n"; w.String() != expected {
+		t.Fatalf("expected %s, got %s", expected, w.String())
+	}
+}
+
+func TestNewChain(t *testing.T) {
+	first, second := newMemoryStore(), newMemoryStore()
+	second.Add(&Credentials{ServerURL: "https://quay.io", Username: "foo", Secret: "bar"})
+	Register("test-chain-first", func() (Helper, error) { return first, nil })
+	Register("test-chain-second", func() (Helper, error) { return second, nil })
+	defer unregister("test-chain-first", "test-chain-second")
+
+	h, err := newChain(strings.Split("test-chain-first, test-chain-second", ","))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend, found, err := Resolve(h, "https://quay.io")
+	if err != nil || !found || backend != "test-chain-second" {
+		t.Fatalf("expected test-chain-second, got %q, %v, %v", backend, found, err)
+	}
+
+	if _, err := newChain([]string{"test-chain-first", "test-chain-unknown"}); err == nil {
+		t.Fatal("expected an unknown backend to be rejected")
+	}
+}
@@ -0,0 +1,58 @@
+package credentials
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+// Checker is the interface implemented by helpers which can check that their
+// backend is reachable and accepts their credentials, with a call which
+// changes nothing.
+type Checker interface {
+	// Check runs a harmless authenticated call against the backend.
+	Check() error
+}
+
+// Check checks the backend of a helper. Helpers which do not implement
+// Checker are checked by listing their credentials.
+func Check(helper Helper) error {
+	if c, ok := helper.(Checker); ok {
+		return c.Check()
+	}
+	_, err := helper.List()
+	return err
+}
+
+// CheckResult reports the outcome of a check.
+type CheckResult struct {
+	OK         bool
+	Reachable  bool
+	Authorized bool
+	Latency    string
+	Error      string `json:",omitempty"`
+}
+
+// PrintCheck checks the backend of a helper and writes the JSON serialization
+// of the CheckResult. The backend is reported unreachable for errors of kind
+// ErrBackendUnavailable or ErrTimeout, and unauthorized for errors of kind
+// ErrPermissionDenied. When the check fails, its error is returned once the
+// result has been written, and Serve only reports it with its exit code.
+func PrintCheck(helper Helper, writer io.Writer) error {
+	start := time.Now()
+	err := Check(helper)
+	result := CheckResult{OK: err == nil, Latency: time.Since(start).String()}
+	result.Reachable = !errors.Is(err, ErrBackendUnavailable) && !errors.Is(err, ErrTimeout)
+	result.Authorized = result.Reachable && !errors.Is(err, ErrPermissionDenied)
+	if err != nil {
+		result.Error = err.Error()
+	}
+	if encodeErr := json.NewEncoder(writer).Encode(result); encodeErr != nil {
+		return encodeErr
+	}
+	if err != nil {
+		return reportedError{err}
+	}
+	return nil
+}
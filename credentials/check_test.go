@@ -0,0 +1,61 @@
+package credentials
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// failingChecker is a memoryStore whose backend check fails.
+type failingChecker struct {
+	*memoryStore
+	err error
+}
+
+func (f failingChecker) Check() error {
+	return f.err
+}
+
+func TestPrintCheck(t *testing.T) {
+	denied := NewBackendError(ErrPermissionDenied, errors.New("invalid token"))
+	unreachable := NewBackendError(ErrBackendUnavailable, errors.New("connection refused"))
+	cases := []struct {
+		name   string
+		helper Helper
+		result CheckResult
+	}{
+		{"default", newMemoryStore(), CheckResult{OK: true, Reachable: true, Authorized: true}},
+		{"denied", failingChecker{newMemoryStore(), denied}, CheckResult{Reachable: true, Error: "invalid token"}},
+		{"unreachable", failingChecker{newMemoryStore(), unreachable}, CheckResult{Error: "connection refused"}},
+		{"chained", Chain(newMemoryStore(), Named("remote", failingChecker{newMemoryStore(), unreachable})), CheckResult{Error: "remote: connection refused"}},
+		{"decorated", WithAliases(failingChecker{newMemoryStore(), denied}, Aliases{}), CheckResult{Reachable: true, Error: "invalid token"}},
+	}
+	for _, c := range cases {
+		w := new(bytes.Buffer)
+		err := HandleCommand(c.helper, "check", nil, w)
+		if c.result.OK != (err == nil) {
+			t.Fatalf("%s: unexpected error %v", c.name, err)
+		}
+		if err != nil {
+			// Serve must not write the error after the result.
+			output := new(bytes.Buffer)
+			reportError(output, err)
+			if output.Len() != 0 {
+				t.Fatalf("%s: expected the error to only be reported by the result, got %q", c.name, output)
+			}
+		}
+
+		var result CheckResult
+		if err := json.NewDecoder(w).Decode(&result); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if result.Latency == "" {
+			t.Fatalf("%s: expected the latency to be reported", c.name)
+		}
+		result.Latency = ""
+		if result != c.result {
+			t.Fatalf("%s: expected %+v, got %+v", c.name, c.result, result)
+		}
+	}
+}
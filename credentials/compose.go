@@ -0,0 +1,125 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// ComposeEnv is the environment variable holding the composition served by
+// ServeBackend instead of the backend selected with --backend, as given to
+// Compose, or the path of a file holding it, starting with '/' or '.'.
+const ComposeEnv = "DOCKER_CREDS_COMPOSE"
+
+// readOnlyHelper rejects the writes of a helper.
+type readOnlyHelper struct {
+	decorator
+}
+
+// WithReadOnly returns a helper reading credentials from helper, and
+// rejecting store and erase with ErrReadOnly.
+func WithReadOnly(helper Helper) Helper {
+	return readOnlyHelper{decorator: decorator{helper}}
+}
+
+func (h readOnlyHelper) Add(creds *Credentials) error {
+	return ErrReadOnly
+}
+
+func (h readOnlyHelper) AddWithMeta(creds *ExtendedCredentials) error {
+	return ErrReadOnly
+}
+
+func (h readOnlyHelper) Delete(serverURL string) error {
+	return ErrReadOnly
+}
+
+// Compose assembles a helper from registered backends and decorators. The
+// composition is a list of layers separated by '|' or by newlines, each
+// wrapping the previous ones. Empty layers and lines starting with '#' are
+// ignored. The first layer is a comma separated list of backends, chained
+// like the value of --backend, and the other layers are one of:
+//
+//	cache=<ttl>          keeps the credentials of the previous layers in
+//	                     memory for ttl, see WithCache, as CacheTTLEnv does
+//	                     for the whole helper
+//	readonly             rejects store and erase, see WithReadOnly
+//	wildcards            matches wildcard entries, see WithWildcards
+//	aliases=<aliases>    reuses credentials, as the value of AliasesEnv
+//	mirror=<backend>     copies writes to a backend, see WithMirror
+//
+// For instance, "env,pass | wildcards | readonly" serves the credentials of
+// env, then pass, including wildcard entries, and rejects writes. The cache
+// lives as long as the process, so a cache layer, as in
+// "pass | cache=5m | readonly", is meant for compositions served by a
+// long-lived program, such as ServeCache. CacheTTLEnv still applies on top of
+// the composition in ServeBackend.
+func Compose(composition string) (Helper, error) {
+	var layers []string
+	for _, line := range strings.Split(composition, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		for _, layer := range strings.Split(line, "|") {
+			if layer = strings.TrimSpace(layer); layer != "" {
+				layers = append(layers, layer)
+			}
+		}
+	}
+	if len(layers) == 0 {
+		return nil, errors.New("composition: no backend")
+	}
+
+	helper, err := newChain(strings.Split(layers[0], ","))
+	if err != nil {
+		return nil, fmt.Errorf("composition: %v", err)
+	}
+	for _, layer := range layers[1:] {
+		name, value := layer, ""
+		if i := strings.Index(layer, "="); i >= 0 {
+			name, value = strings.TrimSpace(layer[:i]), strings.TrimSpace(layer[i+1:])
+		}
+		switch name {
+		case "cache":
+			ttl, err := time.ParseDuration(value)
+			if err != nil || ttl <= 0 {
+				return nil, fmt.Errorf("composition: invalid cache TTL %q, expected a duration such as 30s", value)
+			}
+			helper = WithCache(helper, ttl)
+		case "readonly":
+			helper = WithReadOnly(helper)
+		case "wildcards":
+			helper = WithWildcards(helper)
+		case "aliases":
+			aliases, err := loadAliases("composition aliases", value)
+			if err != nil {
+				return nil, err
+			}
+			helper = WithAliases(helper, aliases)
+		case "mirror":
+			if helper, err = newMirror(helper, value); err != nil {
+				return nil, fmt.Errorf("composition: %v", err)
+			}
+		default:
+			return nil, fmt.Errorf("composition: unknown layer %q", name)
+		}
+	}
+	return helper, nil
+}
+
+// composeFromEnv assembles the helper described by ComposeEnv, which must
+// be set.
+func composeFromEnv() (Helper, error) {
+	value := os.Getenv(ComposeEnv)
+	if strings.HasPrefix(value, "/") || strings.HasPrefix(value, ".") {
+		content, err := ioutil.ReadFile(value)
+		if err != nil {
+			return nil, err
+		}
+		value = string(content)
+	}
+	return Compose(value)
+}
@@ -0,0 +1,112 @@
+package credentials
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCompose(t *testing.T) {
+	primary := &countingStore{memoryStore: newMemoryStore()}
+	secondary, mirror := newMemoryStore(), newMemoryStore()
+	secondary.Add(&Credentials{ServerURL: "https://quay.io", Username: "secondary", Secret: "bar"})
+	Register("test-compose-primary", func() (Helper, error) { return primary, nil })
+	Register("test-compose-secondary", func() (Helper, error) { return secondary, nil })
+	Register("test-compose-mirror", func() (Helper, error) { return mirror, nil })
+	defer unregister("test-compose-primary", "test-compose-secondary", "test-compose-mirror")
+
+	h, err := Compose("test-compose-primary, test-compose-secondary | cache=1m | readonly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary.memoryStore.Add(&Credentials{ServerURL: "https://index.docker.io/v1/", Username: "primary", Secret: "foo"})
+
+	// The chain serves the credentials of both backends, from the cache.
+	for i := 0; i < 2; i++ {
+		if username, _, err := h.Get("https://index.docker.io/v1/"); err != nil || username != "primary" {
+			t.Fatalf("expected the credentials of the first backend, got %s, %v", username, err)
+		}
+	}
+	if primary.lookups != 1 {
+		t.Fatalf("expected the second get to hit the cache, got %d lookups", primary.lookups)
+	}
+	if username, _, err := h.Get("https://quay.io"); err != nil || username != "secondary" {
+		t.Fatalf("expected the credentials of the second backend, got %s, %v", username, err)
+	}
+	if backend, found, _ := Resolve(h, "https://quay.io"); !found || backend != "test-compose-secondary" {
+		t.Fatalf("expected the second backend to be resolved, got %s", backend)
+	}
+
+	// The outermost layer rejects writes.
+	if err := h.Add(&Credentials{ServerURL: "https://gcr.io", Username: "foo", Secret: "bar"}); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+	if err := h.Delete("https://index.docker.io/v1/"); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+
+	// Layers can be given one per line, with comments.
+	h, err = Compose("# Hub credentials, mirrored.\ntest-compose-primary\nmirror=test-compose-mirror\naliases=mirror.example.com=https://index.docker.io/v1/\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Add(&Credentials{ServerURL: "https://gcr.io", Username: "foo", Secret: "bar"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := mirror.creds["https://gcr.io"]; !ok {
+		t.Fatal("expected the write to be mirrored")
+	}
+	if username, _, err := h.Get("mirror.example.com"); err != nil || username != "primary" {
+		t.Fatalf("expected the aliased credentials, got %s, %v", username, err)
+	}
+}
+
+func TestComposeErrors(t *testing.T) {
+	Register("test-compose-errors", func() (Helper, error) { return newMemoryStore(), nil })
+	defer unregister("test-compose-errors")
+	cases := map[string]string{
+		"":                                 "composition: no backend",
+		"test-compose-errors | cache=soon": `composition: invalid cache TTL "soon", expected a duration such as 30s`,
+		"test-compose-errors | encrypt":    `composition: unknown layer "encrypt"`,
+	}
+	for composition, expected := range cases {
+		if _, err := Compose(composition); err == nil || err.Error() != expected {
+			t.Fatalf("%q: expected error %q, got %v", composition, expected, err)
+		}
+	}
+	if _, err := Compose("test-compose-missing"); err == nil {
+		t.Fatal("expected an unknown backend to be rejected")
+	}
+}
+
+func TestComposeFromFile(t *testing.T) {
+	Register("test-compose-file", func() (Helper, error) { return newMemoryStore(), nil })
+	defer unregister("test-compose-file")
+	dir, err := ioutil.TempDir("", "compose")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "compose.conf")
+	if err := ioutil.WriteFile(path, []byte("test-compose-file\ncache=30s\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Setenv(ComposeEnv, os.Getenv(ComposeEnv))
+	os.Setenv(ComposeEnv, path)
+	h, err := composeFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, ok := h.(*cachedHelper); !ok || c.ttl != 30*time.Second {
+		t.Fatalf("expected a 30s cache, got %#v", h)
+	}
+
+	os.Setenv(ComposeEnv, filepath.Join(dir, "missing.conf"))
+	if _, err := composeFromEnv(); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected a missing file error, got %v", err)
+	}
+}
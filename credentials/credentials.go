@@ -1,13 +1,14 @@
 package credentials
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"unicode/utf8"
 )
 
 // Credentials holds the information shared between docker and the credentials store.
@@ -17,6 +18,14 @@ type Credentials struct {
 	Secret    string
 }
 
+// IsAnonymous reports whether the credentials have neither a username nor a
+// secret. Stored for a server URL, such credentials make docker access its
+// registry anonymously, and get returns them, unlike server URLs without
+// credentials, for which it reports ErrCredentialsNotFound.
+func (c *Credentials) IsAnonymous() bool {
+	return c.Username == "" && c.Secret == ""
+}
+
 // isValid checks the integrity of Credentials object such that no credentials lack
 // a server URL or a username.
 // It returns whether the credentials are valid and the error if it isn't.
@@ -48,23 +57,94 @@ func SetCredsLabel(label string) {
 // It uses os.Args[1] as the key for the action.
 // It uses os.Stdin as input and os.Stdout as output.
 // This function terminates the program with os.Exit(1) if there is an error.
+//
+// The store action also accepts the server URL and the username as flags,
+// as in "store --url <url> --user <username>", reading only the secret from
+// os.Stdin, so that it never appears in the arguments of the process.
+//
+// SIGINT and SIGTERM cancel the OperationContext of the helper, and the
+// program exits once the operation returns or ShutdownGrace has elapsed.
 func Serve(helper Helper) {
 	var err error
-	if len(os.Args) != 2 {
-		err = fmt.Errorf("Usage: %s <store|get|erase|list|version>", os.Args[0])
+	if !validArgs(os.Args[1:]) {
+		err = fmt.Errorf("Usage: %s %s", os.Args[0], usage)
 	}
 
 	if err == nil {
-		err = HandleCommand(helper, os.Args[1], os.Stdin, os.Stdout)
+		helper, err = configure(helper)
+	}
+
+	if err == nil {
+		err = serveInterruptible(func() error {
+			return handleArgs(helper, os.Args[1:], os.Stdin, os.Stdout)
+		})
 	}
 
 	if err != nil {
-		fmt.Fprintf(os.Stdout, "%v\n", err)
+		reportError(os.Stdout, err)
 		os.Exit(1)
 	}
 }
 
+// usage is the usage message of Serve and ServeBackend, listing the actions
+// handled by HandleCommand.
+const usage = "<store|get|erase|list|prefetch|resolve|check|verify|netrc|version>"
+
+// reportedError is the error of an action which already wrote it in its
+// output, such as a failed check, which Serve only reports with its exit
+// code, so that callers read a single payload.
+type reportedError struct {
+	error
+}
+
+func (e reportedError) Unwrap() error {
+	return e.error
+}
+
+// reportError writes the error of an action, unless the action already
+// wrote it in its output.
+func reportError(writer io.Writer, err error) {
+	if !errors.As(err, new(reportedError)) {
+		fmt.Fprintf(writer, "%v\n", err)
+	}
+}
+
+// configure wraps a helper with the behaviors enabled in the environment,
+// such as the registry aliases of AliasesEnv.
+func configure(helper Helper) (Helper, error) {
+	if wildcardsFromEnv() {
+		helper = WithWildcards(helper)
+	}
+
+	aliases, err := aliasesFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if aliases != nil {
+		helper = WithAliases(helper, aliases)
+	}
+
+	usernames, err := defaultUsernamesFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if usernames != nil {
+		helper = WithTransforms(helper, usernames)
+	}
+
+	ttl, err := cacheTTLFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if ttl > 0 {
+		helper = WithCache(helper, ttl)
+	}
+	return helper, nil
+}
+
 // HandleCommand uses a helper and a key to run a credential action.
+// Keys outside of the supported actions are rejected with an
+// "unsupported operation" error, without reading the input.
 func HandleCommand(helper Helper, key string, in io.Reader, out io.Writer) error {
 	switch key {
 	case "store":
@@ -75,108 +155,269 @@ func HandleCommand(helper Helper, key string, in io.Reader, out io.Writer) error
 		return Erase(helper, in)
 	case "list":
 		return List(helper, out)
+	case "prefetch":
+		return Prefetch(helper)
+	case "resolve":
+		return PrintResolve(helper, in, out)
+	case "check":
+		return PrintCheck(helper, out)
+	case "verify":
+		return PrintVerify(helper, out)
+	case "netrc":
+		return ExportNetrc(helper, out)
 	case "version":
 		return PrintVersion(out)
 	}
-	return fmt.Errorf("Unknown credential action `%s`", key)
+	return fmt.Errorf("unsupported operation: %s", key)
 }
 
-// Store uses a helper and an input reader to save credentials.
-// The reader must contain the JSON serialization of a Credentials struct.
-func Store(helper Helper, reader io.Reader) error {
-	scanner := bufio.NewScanner(reader)
+// validArgs checks that args hold an action, and flags only for store.
+func validArgs(args []string) bool {
+	return len(args) == 1 || len(args) > 1 && args[0] == "store"
+}
 
-	buffer := new(bytes.Buffer)
-	for scanner.Scan() {
-		buffer.Write(scanner.Bytes())
+// handleArgs runs the action of args, which may be a store with flags.
+func handleArgs(helper Helper, args []string, in io.Reader, out io.Writer) error {
+	if len(args) == 1 {
+		return HandleCommand(helper, args[0], in, out)
 	}
-
-	if err := scanner.Err(); err != nil && err != io.EOF {
+	serverURL, username, err := parseStoreFlags(args[1:])
+	if err != nil {
 		return err
 	}
+	return StoreSecret(helper, serverURL, username, in)
+}
+
+// parseStoreFlags extracts the --url and --user flags of a store action.
+// Values are never included in errors, in case a secret was passed by mistake.
+func parseStoreFlags(args []string) (string, string, error) {
+	var serverURL, username string
+	for i := 0; i < len(args); i++ {
+		name, value := args[i], ""
+		hasValue := false
+		if j := strings.Index(name, "="); j >= 0 {
+			name, value, hasValue = name[:j], name[j+1:], true
+		}
+		var dst *string
+		switch name {
+		case "--url", "-url":
+			dst = &serverURL
+		case "--user", "-user":
+			dst = &username
+		default:
+			if !strings.HasPrefix(name, "-") {
+				return "", "", errors.New("unexpected positional argument for store, the secret is read from the standard input")
+			}
+			return "", "", errors.New("unknown flag for store, only --url and --user are supported and the secret is read from the standard input")
+		}
+		if !hasValue {
+			if i+1 == len(args) {
+				return "", "", fmt.Errorf("missing value for %s", name)
+			}
+			i++
+			value = args[i]
+		}
+		*dst = value
+	}
+	return serverURL, username, nil
+}
 
-	var creds Credentials
-	if err := json.NewDecoder(buffer).Decode(&creds); err != nil {
+// StoreSecret uses a helper to save the credentials of a server URL, whose
+// secret is read from the reader. A single trailing newline is removed from
+// the secret, so that it can be typed or piped with echo.
+func StoreSecret(helper Helper, serverURL, username string, reader io.Reader) error {
+	payload, err := readRequest(reader)
+	if err != nil {
 		return err
 	}
 
+	defer zero(payload)
+
+	secret := payload
+	if n := len(secret); n > 0 && secret[n-1] == '\n' {
+		secret = secret[:n-1]
+		if n := len(secret); n > 0 && secret[n-1] == '\r' {
+			secret = secret[:n-1]
+		}
+	}
+
+	creds := &ExtendedCredentials{
+		Credentials: Credentials{ServerURL: serverURL, Username: username, Secret: string(secret)},
+	}
 	if ok, err := creds.isValid(); !ok {
 		return err
 	}
+	if creds.Secret == "" {
+		return NewErrCredentialsMissingSecret()
+	}
+	if err := recordAuthType(creds); err != nil {
+		return err
+	}
 
-	return helper.Add(&creds)
+	return AddWithMeta(helper, creds)
 }
 
-// Get retrieves the credentials for a given server url.
-// The reader must contain the server URL to search.
-// The writer is used to write the JSON serialization of the credentials.
-func Get(helper Helper, reader io.Reader, writer io.Writer) error {
-	scanner := bufio.NewScanner(reader)
-
-	buffer := new(bytes.Buffer)
-	for scanner.Scan() {
-		buffer.Write(scanner.Bytes())
+// Store uses a helper and an input reader to save credentials.
+// The reader must contain the JSON serialization of a Credentials struct,
+// with a server URL, a username and a secret, and no other field but the
+// Metadata of ExtendedCredentials. Anonymous credentials are stored when
+// the username and the secret are both given and empty, by the helpers
+// supporting them. The metadata is only stored by helpers implementing
+// MetadataHelper. Credentials with the IdentityTokenUsername are recorded
+// with the AuthTypeIdentityToken auth type.
+func Store(helper Helper, reader io.Reader) error {
+	payload, err := readRequest(reader)
+	if err != nil {
+		return err
 	}
 
-	if err := scanner.Err(); err != nil && err != io.EOF {
+	defer zero(payload)
+
+	creds, err := decodeStoreRequest(payload)
+	if err != nil {
 		return err
 	}
+	if err := recordAuthType(creds); err != nil {
+		return err
+	}
+
+	return AddWithMeta(helper, creds)
+}
 
-	serverURL := strings.TrimSpace(buffer.String())
-	if len(serverURL) == 0 {
-		return NewErrCredentialsMissingServerURL()
+// Get retrieves the credentials for a given server url.
+// The reader must contain the server URL to search.
+// The writer is used to write the JSON serialization of the credentials,
+// along with their metadata for helpers implementing MetadataHelper, or
+// their encoding by the Encoder in use.
+// Credentials recorded with the AuthTypeIdentityToken auth type are written
+// with the IdentityTokenUsername, which docker reads as an identity token.
+//
+// The buffer holding the serialization is zeroed once it has been written,
+// so the writer must not retain it. This only shortens the time the secret
+// stays in memory: the strings returned by the helper are immutable and
+// remain reachable until they are garbage collected, and encoding/json keeps
+// its own scratch buffers.
+//
+// JSON strings are UTF-8, so credentials which are not valid UTF-8, such as
+// binary tokens, are rejected with an error rather than being written with
+// their invalid bytes replaced.
+func Get(helper Helper, reader io.Reader, writer io.Writer) error {
+	payload, err := readRequest(reader)
+	if err != nil {
+		return err
 	}
 
-	username, secret, err := helper.Get(serverURL)
+	serverURL, err := parseServerURL("get", payload)
 	if err != nil {
 		return err
 	}
 
-	resp := Credentials{
-		ServerURL: serverURL,
-		Username:  username,
-		Secret:    secret,
+	resp, err := GetWithMeta(helper, serverURL)
+	if err != nil {
+		return err
+	}
+	resp.ServerURL = serverURL
+	applyAuthType(resp)
+	if err := checkUTF8(resp); err != nil {
+		return err
 	}
 
-	buffer.Reset()
-	if err := json.NewEncoder(buffer).Encode(resp); err != nil {
+	buffer := new(bytes.Buffer)
+	defer func() { zero(buffer.Bytes()) }()
+	if err := Encoder.EncodeResponse(buffer, resp); err != nil {
 		return err
 	}
 
-	fmt.Fprint(writer, buffer.String())
+	_, err = writer.Write(buffer.Bytes())
+	return err
+}
+
+// checkUTF8 checks that credentials can be serialized without losing data.
+func checkUTF8(creds *ExtendedCredentials) error {
+	if !utf8.ValidString(creds.Username) {
+		return fmt.Errorf("the username stored for %s is not valid UTF-8", creds.ServerURL)
+	}
+	if !utf8.ValidString(creds.Secret) {
+		return fmt.Errorf("the secret stored for %s is not valid UTF-8", creds.ServerURL)
+	}
+	for k, v := range creds.Metadata {
+		if !utf8.ValidString(k) || !utf8.ValidString(v) {
+			return fmt.Errorf("the metadata stored for %s is not valid UTF-8", creds.ServerURL)
+		}
+	}
 	return nil
 }
 
+// zero overwrites a buffer which held secrets.
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
 // Erase removes credentials from the store.
 // The reader must contain the server URL to remove.
 func Erase(helper Helper, reader io.Reader) error {
-	scanner := bufio.NewScanner(reader)
-
-	buffer := new(bytes.Buffer)
-	for scanner.Scan() {
-		buffer.Write(scanner.Bytes())
-	}
-
-	if err := scanner.Err(); err != nil && err != io.EOF {
+	payload, err := readRequest(reader)
+	if err != nil {
 		return err
 	}
 
-	serverURL := strings.TrimSpace(buffer.String())
-	if len(serverURL) == 0 {
-		return NewErrCredentialsMissingServerURL()
+	serverURL, err := parseServerURL("erase", payload)
+	if err != nil {
+		return err
 	}
 
 	return helper.Delete(serverURL)
 }
 
 //List returns all the serverURLs of keys in
-//the OS store as a list of strings
+//the OS store as a list of strings.
+//The JSON object is written with its keys sorted by server URL, so
+//listing an unchanged store always produces the same output.
 func List(helper Helper, writer io.Writer) error {
 	accts, err := helper.List()
 	if err != nil {
 		return err
 	}
-	return json.NewEncoder(writer).Encode(accts)
+	return Encoder.EncodeResponse(writer, accts)
+}
+
+// Prefetch warms the cache of a helper implementing Prefetcher.
+// It is a no-op for helpers without a cache.
+func Prefetch(helper Helper) error {
+	if p, ok := helper.(Prefetcher); ok {
+		return p.Prefetch()
+	}
+	return nil
+}
+
+// Resolution reports which backend serves the credentials of a server URL.
+type Resolution struct {
+	ServerURL string
+	Backend   string `json:",omitempty"`
+	Found     bool
+}
+
+// PrintResolve writes the JSON serialization of the Resolution of the server
+// URL contained in the reader, which tells which backend would answer a get
+// for it, without the credentials themselves.
+func PrintResolve(helper Helper, reader io.Reader, writer io.Writer) error {
+	payload, err := readRequest(reader)
+	if err != nil {
+		return err
+	}
+
+	serverURL, err := parseServerURL("resolve", payload)
+	if err != nil {
+		return err
+	}
+
+	backend, found, err := Resolve(helper, serverURL)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(writer).Encode(Resolution{ServerURL: serverURL, Backend: backend, Found: found})
 }
 
 //PrintVersion outputs the current version.
@@ -3,7 +3,6 @@ package credentials
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
 	"strings"
 	"testing"
 )
@@ -31,14 +30,17 @@ func (m *memoryStore) Delete(serverURL string) error {
 func (m *memoryStore) Get(serverURL string) (string, string, error) {
 	c, ok := m.creds[serverURL]
 	if !ok {
-		return "", "", fmt.Errorf("creds not found for %s", serverURL)
+		return "", "", NewErrCredentialsNotFound()
 	}
 	return c.Username, c.Secret, nil
 }
 
 func (m *memoryStore) List() (map[string]string, error) {
-	//Simply a placeholder to let memoryStore be a valid implementation of Helper interface
-	return nil, nil
+	accts := make(map[string]string)
+	for serverURL, c := range m.creds {
+		accts[serverURL] = c.Username
+	}
+	return accts, nil
 }
 
 func TestStore(t *testing.T) {
@@ -247,3 +249,195 @@ func TestList(t *testing.T) {
 		t.Fatalf("expected output in the writer, got %d", 0)
 	}
 }
+
+func TestListStableOrder(t *testing.T) {
+	h := newMemoryStore()
+	for _, serverURL := range []string{"https://registry.example.com", "https://index.docker.io/v1/", "https://a.example.com:5000"} {
+		h.Add(&Credentials{ServerURL: serverURL, Username: "foo", Secret: "bar"})
+	}
+
+	expected := `{"https://a.example.com:5000":"foo","https://index.docker.io/v1/":"foo","https://registry.example.com":"foo"}` + "\n"
+	for i := 0; i < 10; i++ {
+		out := new(bytes.Buffer)
+		if err := List(h, out); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != expected {
+			t.Fatalf("expected sorted output %s, got %s", expected, out.String())
+		}
+	}
+}
+
+// cachingStore counts the lookups reaching its backing store.
+type cachingStore struct {
+	*memoryStore
+	cache   map[string]*Credentials
+	lookups int
+}
+
+func (c *cachingStore) Get(serverURL string) (string, string, error) {
+	if creds, ok := c.cache[serverURL]; ok {
+		return creds.Username, creds.Secret, nil
+	}
+	c.lookups++
+	return c.memoryStore.Get(serverURL)
+}
+
+func (c *cachingStore) Prefetch() error {
+	c.cache = make(map[string]*Credentials)
+	for serverURL, creds := range c.creds {
+		c.lookups++
+		c.cache[serverURL] = creds
+	}
+	return nil
+}
+
+func TestPrefetch(t *testing.T) {
+	serverURL := "https://index.docker.io/v1/"
+	h := &cachingStore{memoryStore: newMemoryStore()}
+	h.Add(&Credentials{ServerURL: serverURL, Username: "foo", Secret: "bar"})
+
+	if err := HandleCommand(h, "prefetch", strings.NewReader(""), new(bytes.Buffer)); err != nil {
+		t.Fatal(err)
+	}
+	lookups := h.lookups
+
+	w := new(bytes.Buffer)
+	if err := Get(h, strings.NewReader(serverURL), w); err != nil {
+		t.Fatal(err)
+	}
+	if h.lookups != lookups {
+		t.Fatalf("expected get to be served from the cache, got %d store lookups", h.lookups-lookups)
+	}
+
+	// Prefetching is also available through decorators, and a no-op for
+	// helpers without a cache.
+	if err := Prefetch(WithAliases(h, Aliases{})); err != nil {
+		t.Fatal(err)
+	}
+	if err := Prefetch(newMemoryStore()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// retainingWriter keeps the slices it is given, to check what happens to
+// them once written.
+type retainingWriter struct {
+	written [][]byte
+}
+
+func (w *retainingWriter) Write(p []byte) (int, error) {
+	w.written = append(w.written, p)
+	return len(p), nil
+}
+
+func TestGetZeroesResponseBuffer(t *testing.T) {
+	serverURL := "https://index.docker.io/v1/"
+	h := newMemoryStore()
+	h.Add(&Credentials{ServerURL: serverURL, Username: "foo", Secret: "bar"})
+
+	w := &retainingWriter{}
+	if err := Get(h, strings.NewReader(serverURL), w); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(w.written) == 0 {
+		t.Fatal("expected the response to be written")
+	}
+	for _, p := range w.written {
+		if !bytes.Equal(p, make([]byte, len(p))) {
+			t.Fatalf("expected the response buffer to be zeroed, got %q", p)
+		}
+	}
+}
+
+func TestHandleCommandUnsupportedOperation(t *testing.T) {
+	for _, key := range []string{"bogus", "GET", ""} {
+		in := strings.NewReader("https://index.docker.io/v1/")
+		err := HandleCommand(newMemoryStore(), key, in, new(bytes.Buffer))
+		if err == nil || err.Error() != "unsupported operation: "+key {
+			t.Fatalf("expected unsupported operation error for %q, got %v", key, err)
+		}
+		if in.Len() == 0 {
+			t.Fatalf("expected the input not to be read for %q", key)
+		}
+	}
+}
+
+func TestGetInvalidUTF8(t *testing.T) {
+	serverURL := "https://index.docker.io/v1/"
+	h := newMemoryStore()
+	h.Add(&Credentials{ServerURL: serverURL, Username: "foo", Secret: "\xde\xad\xbe\xef"})
+
+	w := new(bytes.Buffer)
+	err := Get(h, strings.NewReader(serverURL), w)
+	if err == nil || err.Error() != "the secret stored for https://index.docker.io/v1/ is not valid UTF-8" {
+		t.Fatalf("expected an invalid UTF-8 error, got %v", err)
+	}
+	if w.Len() != 0 {
+		t.Fatalf("expected no output, got %q", w.String())
+	}
+
+	// Valid UTF-8 secrets are returned byte for byte.
+	h.Add(&Credentials{ServerURL: serverURL, Username: "foo", Secret: "pässwörd☃"})
+	if err := Get(h, strings.NewReader(serverURL), w); err != nil {
+		t.Fatal(err)
+	}
+	var c Credentials
+	if err := json.NewDecoder(w).Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Secret != "pässwörd☃" {
+		t.Fatalf("expected the secret to round-trip, got %q", c.Secret)
+	}
+}
+
+func TestStoreWithFlags(t *testing.T) {
+	h := newMemoryStore()
+	args := []string{"store", "--url", "https://index.docker.io/v1/", "--user=foo"}
+	if err := handleArgs(h, args, strings.NewReader("s3cr3t\n"), new(bytes.Buffer)); err != nil {
+		t.Fatal(err)
+	}
+	c, ok := h.creds["https://index.docker.io/v1/"]
+	if !ok || c.Username != "foo" || c.Secret != "s3cr3t" {
+		t.Fatalf("expected the secret read from stdin to be stored, got %v", h.creds)
+	}
+	for _, arg := range args {
+		if strings.Contains(arg, "s3cr3t") {
+			t.Fatalf("expected the secret not to appear in the arguments, got %v", args)
+		}
+	}
+
+	// Secrets given as flags or arguments are rejected without being echoed.
+	for _, secretArgs := range [][]string{
+		{"store", "--url", "https://quay.io", "--secret=hunter2"},
+		{"store", "--url", "https://quay.io", "--user", "foo", "hunter2"},
+		{"store", "--url", "https://quay.io", "--user", "foo", "-hunter2"},
+	} {
+		w := new(bytes.Buffer)
+		err := handleArgs(h, secretArgs, strings.NewReader(""), w)
+		if err == nil || strings.Contains(err.Error(), "hunter2") || strings.Contains(w.String(), "hunter2") {
+			t.Fatalf("%v: expected an error without the secret, got %v", secretArgs, err)
+		}
+	}
+
+	cases := []struct {
+		args []string
+		in   string
+		err  string
+	}{
+		{[]string{"store", "--user", "foo"}, "s3cr3t", "no credentials server URL"},
+		{[]string{"store", "--url", "https://quay.io"}, "s3cr3t", "no credentials username"},
+		{[]string{"store", "--url", "https://quay.io", "--user", "foo"}, "\n", "no credentials secret"},
+		{[]string{"store", "--url"}, "s3cr3t", "missing value for --url"},
+	}
+	for _, c := range cases {
+		err := handleArgs(h, c.args, strings.NewReader(c.in), new(bytes.Buffer))
+		if err == nil || err.Error() != c.err {
+			t.Fatalf("%v: expected error %q, got %v", c.args, c.err, err)
+		}
+	}
+	if validArgs([]string{"get", "--url", "https://quay.io"}) {
+		t.Fatal("expected flags to be rejected for other actions")
+	}
+}
@@ -0,0 +1,48 @@
+package credentials
+
+// decorator is embedded by the helpers wrapping another helper. It forwards
+// every operation to the wrapped helper, including those of the optional
+// MetadataHelper, BackendResolver, Prefetcher and Checker interfaces, so that
+// the helpers embedding it only implement the operations they change.
+//
+// Go does not dispatch the calls of an embedded type to the methods of the
+// type embedding it, so a decorator changing GetWithMeta must also implement
+// Get, with getCredentials, for both to return the same credentials.
+type decorator struct {
+	Helper
+}
+
+// Get goes through the GetWithMeta of the wrapped helper, so that Get and
+// GetWithMeta always agree.
+func (d decorator) Get(serverURL string) (string, string, error) {
+	return getCredentials(GetWithMeta(d.Helper, serverURL))
+}
+
+func (d decorator) AddWithMeta(creds *ExtendedCredentials) error {
+	return AddWithMeta(d.Helper, creds)
+}
+
+func (d decorator) GetWithMeta(serverURL string) (*ExtendedCredentials, error) {
+	return GetWithMeta(d.Helper, serverURL)
+}
+
+func (d decorator) ResolveBackend(serverURL string) (string, bool, error) {
+	return Resolve(d.Helper, serverURL)
+}
+
+func (d decorator) Prefetch() error {
+	return Prefetch(d.Helper)
+}
+
+func (d decorator) Check() error {
+	return Check(d.Helper)
+}
+
+// getCredentials returns the username and the secret of the result of a
+// GetWithMeta, for Get methods.
+func getCredentials(creds *ExtendedCredentials, err error) (string, string, error) {
+	if err != nil {
+		return "", "", err
+	}
+	return creds.Username, creds.Secret, nil
+}
@@ -0,0 +1,66 @@
+package credentials
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// fullStore is a metadataStore implementing every optional interface.
+type fullStore struct {
+	*metadataStore
+	checkErr   error
+	prefetches int
+}
+
+func (f *fullStore) Check() error {
+	return f.checkErr
+}
+
+func (f *fullStore) Prefetch() error {
+	f.prefetches++
+	return nil
+}
+
+func TestDecoratorsForward(t *testing.T) {
+	serverURL := "https://registry.example.com"
+	errCheck := errors.New("check failed")
+	decorators := map[string]func(Helper) Helper{
+		"aliases":    func(h Helper) Helper { return WithAliases(h, Aliases{}) },
+		"wildcards":  WithWildcards,
+		"named":      func(h Helper) Helper { return Named("store", h) },
+		"transforms": func(h Helper) Helper { return WithTransforms(h) },
+		"cache":      func(h Helper) Helper { return WithCache(h, time.Minute) },
+		"readonly":   WithReadOnly,
+		"mirror":     func(h Helper) Helper { return WithMirror(h, newMemoryStore()) },
+	}
+	for name, decorate := range decorators {
+		store := &fullStore{metadataStore: newMetadataStore(), checkErr: errCheck}
+		store.AddWithMeta(&ExtendedCredentials{
+			Credentials: Credentials{ServerURL: serverURL, Username: "foo", Secret: "bar"},
+			Metadata:    map[string]string{"token_type": "pat"},
+		})
+		h := decorate(store)
+
+		creds, err := GetWithMeta(h, serverURL)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if creds.Metadata["token_type"] != "pat" {
+			t.Fatalf("%s: expected the metadata to be forwarded, got %v", name, creds.Metadata)
+		}
+		username, secret, err := h.Get(serverURL)
+		if err != nil || username != "foo" || secret != "bar" {
+			t.Fatalf("%s: unexpected credentials %s:%s, %v", name, username, secret, err)
+		}
+		if _, found, err := Resolve(h, serverURL); err != nil || !found {
+			t.Fatalf("%s: expected the credentials to be resolved, got %v, %v", name, found, err)
+		}
+		if err := Check(h); !errors.Is(err, errCheck) {
+			t.Fatalf("%s: expected the check to be forwarded, got %v", name, err)
+		}
+		if err := Prefetch(h); err != nil || store.prefetches != 1 {
+			t.Fatalf("%s: expected the prefetch to be forwarded, got %d, %v", name, store.prefetches, err)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package credentials
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// ResponseEncoder writes the responses of the get and list commands: the
+// *ExtendedCredentials found by get and the map of server URLs to usernames
+// returned by list.
+type ResponseEncoder interface {
+	EncodeResponse(w io.Writer, v interface{}) error
+}
+
+// ResponseEncoderFunc is a function implementing ResponseEncoder.
+type ResponseEncoderFunc func(w io.Writer, v interface{}) error
+
+// EncodeResponse calls f(w, v).
+func (f ResponseEncoderFunc) EncodeResponse(w io.Writer, v interface{}) error {
+	return f(w, v)
+}
+
+// JSONEncoder writes responses as JSON documents followed by a newline, which
+// is the format docker expects.
+var JSONEncoder ResponseEncoder = ResponseEncoderFunc(func(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+})
+
+// Encoder holds the ResponseEncoder used by Get and List. Default value is
+// JSONEncoder. Other encoders break the protocol docker speaks, so they are
+// only meant for programs calling the helper for other purposes, such as
+// logging.
+var Encoder = JSONEncoder
+
+// SetResponseEncoder is a simple setter for Encoder
+func SetResponseEncoder(encoder ResponseEncoder) {
+	Encoder = encoder
+}
@@ -0,0 +1,45 @@
+package credentials
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestResponseEncoder(t *testing.T) {
+	defer SetResponseEncoder(Encoder)
+
+	var encoded []interface{}
+	SetResponseEncoder(ResponseEncoderFunc(func(w io.Writer, v interface{}) error {
+		encoded = append(encoded, v)
+		if creds, ok := v.(*ExtendedCredentials); ok {
+			_, err := fmt.Fprintf(w, "%s %s\n", creds.ServerURL, creds.Username)
+			return err
+		}
+		return JSONEncoder.EncodeResponse(w, v)
+	}))
+
+	h := newMemoryStore()
+	h.Add(&Credentials{ServerURL: "https://index.docker.io/v1/", Username: "foo", Secret: "bar"})
+
+	w := new(bytes.Buffer)
+	if err := Get(h, strings.NewReader("https://index.docker.io/v1/"), w); err != nil {
+		t.Fatal(err)
+	}
+	if w.String() != "https://index.docker.io/v1/ foo\n" {
+		t.Fatalf("expected the custom encoding of the credentials, got %q", w.String())
+	}
+
+	w.Reset()
+	if err := List(h, w); err != nil {
+		t.Fatal(err)
+	}
+	if w.String() != `{"https://index.docker.io/v1/":"foo"}`+"\n" {
+		t.Fatalf("unexpected list output %q", w.String())
+	}
+	if len(encoded) != 2 {
+		t.Fatalf("expected the encoder to be used by get and list, got %v", encoded)
+	}
+}
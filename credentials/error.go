@@ -1,14 +1,22 @@
 package credentials
 
+import (
+	"errors"
+	"net"
+	"net/http"
+)
+
 const (
 	// ErrCredentialsNotFound standardizes the not found error, so every helper returns
 	// the same message and docker can handle it properly.
 	errCredentialsNotFoundMessage = "credentials not found in native keychain"
 
-	// ErrCredentialsMissingServerURL and ErrCredentialsMissingUsername standardize
+	// ErrCredentialsMissingServerURL, ErrCredentialsMissingUsername and
+	// ErrCredentialsMissingSecret standardize
 	// invalid credentials or credentials management operations
 	errCredentialsMissingServerURLMessage = "no credentials server URL"
 	errCredentialsMissingUsernameMessage  = "no credentials username"
+	errCredentialsMissingSecretMessage    = "no credentials secret"
 )
 
 // errCredentialsNotFound represents an error
@@ -30,8 +38,7 @@ func NewErrCredentialsNotFound() error {
 // IsErrCredentialsNotFound returns true if the error
 // was caused by not having a set of credentials in a store.
 func IsErrCredentialsNotFound(err error) bool {
-	_, ok := err.(errCredentialsNotFound)
-	return ok
+	return errors.As(err, new(errCredentialsNotFound))
 }
 
 // IsErrCredentialsNotFoundMessage returns true if the error
@@ -78,8 +85,7 @@ func NewErrCredentialsMissingUsername() error {
 // IsCredentialsMissingServerURL returns true if the error
 // was an errCredentialsMissingServerURL.
 func IsCredentialsMissingServerURL(err error) bool {
-	_, ok := err.(errCredentialsMissingServerURL)
-	return ok
+	return errors.As(err, new(errCredentialsMissingServerURL))
 }
 
 // IsCredentialsMissingServerURLMessage checks for an
@@ -91,8 +97,7 @@ func IsCredentialsMissingServerURLMessage(err string) bool {
 // IsCredentialsMissingUsername returns true if the error
 // was an errCredentialsMissingUsername.
 func IsCredentialsMissingUsername(err error) bool {
-	_, ok := err.(errCredentialsMissingUsername)
-	return ok
+	return errors.As(err, new(errCredentialsMissingUsername))
 }
 
 // IsCredentialsMissingUsernameMessage checks for an
@@ -100,3 +105,110 @@ func IsCredentialsMissingUsername(err error) bool {
 func IsCredentialsMissingUsernameMessage(err string) bool {
 	return err == errCredentialsMissingUsernameMessage
 }
+
+// errCredentialsMissingSecret represents an error raised
+// when the credentials object sent to store has no secret.
+type errCredentialsMissingSecret struct{}
+
+func (errCredentialsMissingSecret) Error() string {
+	return errCredentialsMissingSecretMessage
+}
+
+// NewErrCredentialsMissingSecret creates a new error for
+// errCredentialsMissingSecret.
+func NewErrCredentialsMissingSecret() error {
+	return errCredentialsMissingSecret{}
+}
+
+// IsCredentialsMissingSecret returns true if the error
+// was an errCredentialsMissingSecret.
+func IsCredentialsMissingSecret(err error) bool {
+	return errors.As(err, new(errCredentialsMissingSecret))
+}
+
+// IsCredentialsMissingSecretMessage checks for an
+// errCredentialsMissingSecret in the error message.
+func IsCredentialsMissingSecretMessage(err string) bool {
+	return err == errCredentialsMissingSecretMessage
+}
+
+// Kinds of backend failures. Helpers report their failures as a *BackendError
+// of one of these kinds, which callers can check with errors.Is, as in
+// errors.Is(err, credentials.ErrPermissionDenied).
+var (
+	// ErrBackendUnavailable reports a backend which cannot be reached.
+	ErrBackendUnavailable = errors.New("credentials backend unavailable")
+	// ErrPermissionDenied reports credentials or access rights to the
+	// backend which are missing or refused.
+	ErrPermissionDenied = errors.New("credentials backend permission denied")
+	// ErrTimeout reports a backend which did not answer in time.
+	ErrTimeout = errors.New("credentials backend timeout")
+	// ErrNotInitialized reports a backend which has not been set up yet,
+	// such as a password store without keys.
+	ErrNotInitialized = errors.New("credentials backend not initialized")
+)
+
+// ErrReadOnly is returned when storing or erasing credentials with a helper
+// which cannot write them, such as the helpers created by WithReadOnly and
+// the backends serving credentials from the environment or a file, so that
+// callers can check for it with errors.Is whatever the backend.
+var ErrReadOnly = errors.New("credentials are read-only")
+
+// ErrAnonymousUnsupported is returned when storing anonymous credentials with
+// a backend which cannot store them, such as the native keychains.
+var ErrAnonymousUnsupported = errors.New("anonymous credentials are not supported by this helper")
+
+// BackendError is a failure of a backend, classified by kind. Its message is
+// the message of the underlying error, so classifying an error does not
+// change how it is reported.
+type BackendError struct {
+	// Kind is one of ErrBackendUnavailable, ErrPermissionDenied, ErrTimeout
+	// and ErrNotInitialized.
+	Kind error
+	// Err is the underlying error.
+	Err error
+}
+
+// NewBackendError classifies err as a failure of the given kind.
+func NewBackendError(kind, err error) error {
+	return &BackendError{Kind: kind, Err: err}
+}
+
+func (e *BackendError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *BackendError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the kind of the failure.
+func (e *BackendError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// ClassifyHTTPStatus classifies err, the failure of a request to an HTTP
+// backend which answered with the given status code. Errors of statuses
+// without a matching kind are returned unchanged.
+func ClassifyHTTPStatus(status int, err error) error {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return NewBackendError(ErrPermissionDenied, err)
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return NewBackendError(ErrTimeout, err)
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return NewBackendError(ErrBackendUnavailable, err)
+	}
+	return err
+}
+
+// ClassifyTransportError classifies err, the failure to send a request to a
+// network backend, as a timeout or an unavailable backend.
+func ClassifyTransportError(err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return NewBackendError(ErrTimeout, err)
+	}
+	return NewBackendError(ErrBackendUnavailable, err)
+}
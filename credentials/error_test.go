@@ -0,0 +1,65 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// timeoutError is a net.Error reporting a timeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestBackendErrorKinds(t *testing.T) {
+	cause := errors.New("server said no")
+	tests := []struct {
+		err  error
+		kind error
+	}{
+		{ClassifyHTTPStatus(http.StatusUnauthorized, cause), ErrPermissionDenied},
+		{ClassifyHTTPStatus(http.StatusForbidden, cause), ErrPermissionDenied},
+		{ClassifyHTTPStatus(http.StatusGatewayTimeout, cause), ErrTimeout},
+		{ClassifyHTTPStatus(http.StatusServiceUnavailable, cause), ErrBackendUnavailable},
+		{ClassifyTransportError(fmt.Errorf("dial: %w", timeoutError{})), ErrTimeout},
+		{ClassifyTransportError(cause), ErrBackendUnavailable},
+		{NewBackendError(ErrNotInitialized, cause), ErrNotInitialized},
+	}
+	kinds := []error{ErrBackendUnavailable, ErrPermissionDenied, ErrTimeout, ErrNotInitialized}
+	for _, te := range tests {
+		for _, kind := range kinds {
+			if errors.Is(te.err, kind) != (kind == te.kind) {
+				t.Fatalf("%v: expected kind %v, errors.Is(%v) = %v", te.err, te.kind, kind, !(kind == te.kind))
+			}
+		}
+		if !errors.Is(te.err, cause) && !errors.Is(te.err, timeoutError{}) {
+			t.Fatalf("%v: expected the underlying error to be kept", te.err)
+		}
+		var backendErr *BackendError
+		if !errors.As(te.err, &backendErr) || backendErr.Kind != te.kind {
+			t.Fatalf("%v: expected a *BackendError of kind %v", te.err, te.kind)
+		}
+	}
+
+	if err := ClassifyHTTPStatus(http.StatusConflict, cause); err != cause {
+		t.Fatalf("expected other statuses to be left unclassified, got %v", err)
+	}
+	if err := ClassifyHTTPStatus(http.StatusUnauthorized, cause); err.Error() != cause.Error() {
+		t.Fatalf("expected the message to be unchanged, got %v", err)
+	}
+}
+
+func TestIsErrorsUnwrap(t *testing.T) {
+	if !IsErrCredentialsNotFound(fmt.Errorf("lookup: %w", NewErrCredentialsNotFound())) {
+		t.Fatal("expected a wrapped not found error to be recognized")
+	}
+	if !IsCredentialsMissingServerURL(fmt.Errorf("store: %w", NewErrCredentialsMissingServerURL())) {
+		t.Fatal("expected a wrapped missing server URL error to be recognized")
+	}
+	if IsErrCredentialsNotFound(NewBackendError(ErrTimeout, errors.New("timeout"))) {
+		t.Fatal("expected a backend error not to be a not found error")
+	}
+}
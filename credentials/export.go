@@ -0,0 +1,132 @@
+package credentials
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker-credential-helpers/registryurl"
+)
+
+// SanitizeHost replaces every character of a host but letters, digits, '.'
+// and '-' with '_', as in registry.example.com_5000, for naming files and
+// secrets after the host of a server URL.
+func SanitizeHost(host string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		}
+		return '_'
+	}, host)
+}
+
+// exportName returns the base name of the file holding the credentials of a
+// server URL: its host, sanitized with SanitizeHost.
+func exportName(serverURL string) string {
+	host := serverURL
+	if u, err := registryurl.Parse(serverURL); err == nil {
+		host = u.Host
+	}
+	return SanitizeHost(host)
+}
+
+// ExportDir writes the credentials of every server URL listed by a helper to
+// a directory, one file per server URL, for tools syncing them elsewhere,
+// such as sealed secrets. Each file holds the JSON serialization of the
+// ExtendedCredentials, as read by store, and is named after the host of the
+// server URL, as in registry.example.com_5000.json. Server URLs sharing a
+// host are numbered, as in registry.example.com+2.json, in the order of the
+// server URLs, with a '+' which SanitizeHost never returns, so that they
+// cannot overwrite the file of another host. The directory is created if needed, with 0700 permissions,
+// and the files are written with 0600 permissions.
+func ExportDir(helper Helper, dir string) error {
+	accts, err := helper.List()
+	if err != nil {
+		return err
+	}
+	serverURLs := make([]string, 0, len(accts))
+	for serverURL := range accts {
+		serverURLs = append(serverURLs, serverURL)
+	}
+	sort.Strings(serverURLs)
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	used := map[string]int{}
+	for _, serverURL := range serverURLs {
+		creds, err := GetWithMeta(helper, serverURL)
+		if IsErrCredentialsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		creds.ServerURL = serverURL
+
+		name := exportName(serverURL)
+		used[name]++
+		if n := used[name]; n > 1 {
+			name = fmt.Sprintf("%s+%d", name, n)
+		}
+		data, err := json.Marshal(creds)
+		if err != nil {
+			return err
+		}
+		err = writeSecretFile(filepath.Join(dir, name+".json"), data)
+		zero(data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSecretFile writes a file readable by its owner only, even if it
+// already existed with wider permissions.
+func writeSecretFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ImportDir stores with a helper the credentials of every .json file of a
+// directory, as written by ExportDir. Files are validated like the input of
+// store, and imported in lexical order. It stops at the first invalid file.
+func ImportDir(helper Helper, dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		creds, err := decodeStoreRequest(data)
+		zero(data)
+		if err != nil {
+			return fmt.Errorf("%s: %v", filepath.Base(path), err)
+		}
+		if err := AddWithMeta(helper, creds); err != nil {
+			return fmt.Errorf("%s: %v", filepath.Base(path), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package credentials
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+)
+
+func TestExportImportDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := newMetadataStore()
+	source.Add(&Credentials{ServerURL: "https://index.docker.io/v1/", Username: "foo", Secret: "bar"})
+	source.Add(&Credentials{ServerURL: "index.docker.io", Username: "other", Secret: "baz"})
+	source.Add(&Credentials{ServerURL: "https://index.docker.io-2", Username: "foo", Secret: "qux"})
+	source.AddWithMeta(&ExtendedCredentials{
+		Credentials: Credentials{ServerURL: "registry.example.com:5000", Username: "<token>", Secret: "token"},
+		Metadata:    map[string]string{"token_type": "pat"},
+	})
+
+	if err := ExportDir(source, filepath.Join(dir, "secrets")); err != nil {
+		t.Fatal(err)
+	}
+	files, err := ioutil.ReadDir(filepath.Join(dir, "secrets"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+		if runtime.GOOS != "windows" && f.Mode().Perm() != 0600 {
+			t.Fatalf("expected %s to be written with 0600 permissions, got %v", f.Name(), f.Mode().Perm())
+		}
+	}
+	sort.Strings(names)
+	expected := []string{"index.docker.io+2.json", "index.docker.io-2.json", "index.docker.io.json", "registry.example.com_5000.json"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected files %v, got %v", expected, names)
+	}
+
+	target := newMetadataStore()
+	if err := ImportDir(target, filepath.Join(dir, "secrets")); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(target.creds, source.creds) {
+		t.Fatalf("expected the credentials to round-trip, got %v", target.creds)
+	}
+	if target.meta["registry.example.com:5000"]["token_type"] != "pat" {
+		t.Fatalf("expected the metadata to round-trip, got %v", target.meta)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "secrets", "invalid.json"), []byte(`{"ServerURL": "quay.io"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ImportDir(newMemoryStore(), filepath.Join(dir, "secrets")); err == nil || err.Error() != "invalid.json: no credentials username" {
+		t.Fatalf("expected an invalid file error, got %v", err)
+	}
+}
+
+func TestSanitizeHost(t *testing.T) {
+	cases := map[string]string{
+		"registry.example.com":      "registry.example.com",
+		"registry.example.com:5000": "registry.example.com_5000",
+		"[fe80::1]:5000":            "_fe80__1__5000",
+		"my-registry.example.com":   "my-registry.example.com",
+	}
+	for host, expected := range cases {
+		if name := SanitizeHost(host); name != expected {
+			t.Errorf("expected %q for %q, got %q", expected, host, name)
+		}
+	}
+}
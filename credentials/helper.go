@@ -12,3 +12,10 @@ type Helper interface {
 	// List returns the stored serverURLs and their associated usernames.
 	List() (map[string]string, error)
 }
+
+// Prefetcher is the interface implemented by helpers that keep a cache and
+// can populate it ahead of use, so that subsequent lookups are fast.
+type Prefetcher interface {
+	// Prefetch loads the stored credentials into the cache.
+	Prefetch() error
+}
@@ -0,0 +1,125 @@
+package credentials
+
+import "fmt"
+
+// ExtendedCredentials holds credentials along with metadata describing them,
+// such as the type or the scope of a token. The metadata is serialized as a
+// Metadata object next to the fields of Credentials, which clients unaware of
+// it, such as docker, ignore. It is omitted when empty, so the serialization
+// of credentials without metadata is unchanged.
+type ExtendedCredentials struct {
+	Credentials
+	Metadata map[string]string `json:",omitempty"`
+}
+
+// MetadataHelper is implemented by helpers which can persist the metadata of
+// credentials.
+type MetadataHelper interface {
+	// AddWithMeta stores credentials along with their metadata, replacing
+	// the credentials and the metadata stored for the same server URL.
+	AddWithMeta(creds *ExtendedCredentials) error
+	// GetWithMeta returns the credentials and the metadata stored for a
+	// server URL.
+	GetWithMeta(serverURL string) (*ExtendedCredentials, error)
+}
+
+// AddWithMeta stores credentials with a helper, along with their metadata if
+// the helper implements MetadataHelper. Other helpers drop the metadata.
+func AddWithMeta(helper Helper, creds *ExtendedCredentials) error {
+	if m, ok := helper.(MetadataHelper); ok {
+		return m.AddWithMeta(creds)
+	}
+	if creds == nil {
+		return helper.Add(nil)
+	}
+	return helper.Add(&creds.Credentials)
+}
+
+// GetWithMeta returns the credentials stored by a helper for a server URL,
+// along with their metadata if the helper implements MetadataHelper.
+// Credentials returned by other helpers have no metadata.
+func GetWithMeta(helper Helper, serverURL string) (*ExtendedCredentials, error) {
+	if m, ok := helper.(MetadataHelper); ok {
+		return m.GetWithMeta(serverURL)
+	}
+	username, secret, err := helper.Get(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	return &ExtendedCredentials{
+		Credentials: Credentials{ServerURL: serverURL, Username: username, Secret: secret},
+	}, nil
+}
+
+// Names of the fields of the credentials returned by GetFields.
+const (
+	FieldUsername = "Username"
+	FieldSecret   = "Secret"
+)
+
+// GetFields returns every field stored by a helper for a server URL: the
+// username and the secret, under FieldUsername and FieldSecret, along with
+// the metadata of the credentials, such as an organization ID needed by some
+// registries. The username and the secret take precedence over metadata with
+// the same keys.
+func GetFields(helper Helper, serverURL string) (map[string]string, error) {
+	creds, err := GetWithMeta(helper, serverURL)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string, len(creds.Metadata)+2)
+	for k, v := range creds.Metadata {
+		fields[k] = v
+	}
+	fields[FieldUsername] = creds.Username
+	fields[FieldSecret] = creds.Secret
+	return fields, nil
+}
+
+// MetaCARef is the metadata key of a reference to the CA certificate of a
+// registry with a private CA, such as the path of a PEM file, for tooling
+// configuring TLS connections to it. It is returned by GetFields and
+// GetWithMeta, and is not interpreted by the helpers.
+const MetaCARef = "ca_ref"
+
+// MetaAuthType is the metadata key recording how the secret of credentials
+// authenticates to their registry, either AuthTypePassword or
+// AuthTypeIdentityToken. Credentials without it hold a password.
+const MetaAuthType = "AuthType"
+
+// Values of MetaAuthType.
+const (
+	AuthTypePassword      = "password"
+	AuthTypeIdentityToken = "identitytoken"
+)
+
+// IdentityTokenUsername is the username docker exchanges with helpers for
+// credentials whose secret is an identity token rather than a password.
+const IdentityTokenUsername = "<token>"
+
+// recordAuthType checks the auth type of credentials being stored, marking
+// those sent with IdentityTokenUsername as identity tokens.
+func recordAuthType(creds *ExtendedCredentials) error {
+	switch creds.Metadata[MetaAuthType] {
+	case "":
+		if creds.Username == IdentityTokenUsername {
+			if creds.Metadata == nil {
+				creds.Metadata = map[string]string{}
+			}
+			creds.Metadata[MetaAuthType] = AuthTypeIdentityToken
+		}
+	case AuthTypePassword, AuthTypeIdentityToken:
+	default:
+		return fmt.Errorf("invalid store request: unknown %s %q", MetaAuthType, creds.Metadata[MetaAuthType])
+	}
+	return nil
+}
+
+// applyAuthType returns credentials typed as identity tokens with
+// IdentityTokenUsername, so that docker sends their secret as an identity
+// token instead of a password.
+func applyAuthType(creds *ExtendedCredentials) {
+	if creds.Metadata[MetaAuthType] == AuthTypeIdentityToken {
+		creds.Username = IdentityTokenUsername
+	}
+}
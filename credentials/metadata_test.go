@@ -0,0 +1,207 @@
+package credentials
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// metadataStore is a memoryStore which keeps the metadata of credentials.
+type metadataStore struct {
+	*memoryStore
+	meta map[string]map[string]string
+}
+
+func newMetadataStore() *metadataStore {
+	return &metadataStore{memoryStore: newMemoryStore(), meta: map[string]map[string]string{}}
+}
+
+func (m *metadataStore) AddWithMeta(creds *ExtendedCredentials) error {
+	m.meta[creds.ServerURL] = creds.Metadata
+	return m.Add(&creds.Credentials)
+}
+
+func (m *metadataStore) GetWithMeta(serverURL string) (*ExtendedCredentials, error) {
+	username, secret, err := m.Get(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	return &ExtendedCredentials{
+		Credentials: Credentials{ServerURL: serverURL, Username: username, Secret: secret},
+		Metadata:    m.meta[serverURL],
+	}, nil
+}
+
+const metadataRequest = `{"ServerURL": "https://index.docker.io/v1/", "Username": "foo", "Secret": "bar", "Metadata": {"token_type": "pat", "scope": "repo:read"}}`
+
+func TestMetadataRoundTrip(t *testing.T) {
+	serverURL := "https://index.docker.io/v1/"
+	store := newMetadataStore()
+	helpers := map[string]Helper{
+		"helper":     store,
+		"aliases":    WithAliases(store, Aliases{"mirror.example.com": serverURL}),
+		"wildcards":  WithWildcards(store),
+		"transforms": WithTransforms(store, TransformFuncs{}),
+	}
+	for name, h := range helpers {
+		if err := Store(h, strings.NewReader(metadataRequest)); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		w := new(bytes.Buffer)
+		if err := Get(h, strings.NewReader(serverURL), w); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var c ExtendedCredentials
+		if err := json.NewDecoder(w).Decode(&c); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if c.Username != "foo" || c.Secret != "bar" {
+			t.Fatalf("%s: expected foo:bar, got %s:%s", name, c.Username, c.Secret)
+		}
+		if len(c.Metadata) != 2 || c.Metadata["token_type"] != "pat" || c.Metadata["scope"] != "repo:read" {
+			t.Fatalf("%s: expected the metadata to round-trip, got %v", name, c.Metadata)
+		}
+	}
+
+	c, err := GetWithMeta(helpers["aliases"], "https://mirror.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Metadata["token_type"] != "pat" {
+		t.Fatalf("expected the metadata of the aliased registry, got %v", c.Metadata)
+	}
+}
+
+func TestMetadataUnsupported(t *testing.T) {
+	serverURL := "https://index.docker.io/v1/"
+	h := newMemoryStore()
+	if err := Store(h, strings.NewReader(metadataRequest)); err != nil {
+		t.Fatal(err)
+	}
+
+	w := new(bytes.Buffer)
+	if err := Get(h, strings.NewReader(serverURL), w); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"ServerURL":"https://index.docker.io/v1/","Username":"foo","Secret":"bar"}` + "\n"
+	if w.String() != expected {
+		t.Fatalf("expected the metadata to be dropped, got %s", w.String())
+	}
+}
+
+func TestStoreInvalidMetadata(t *testing.T) {
+	in := strings.NewReader(`{"ServerURL": "https://index.docker.io/v1/", "Username": "foo", "Secret": "bar", "Metadata": {"expires": 42}}`)
+	err := Store(newMetadataStore(), in)
+	if err == nil || err.Error() != "invalid store request: field Metadata must be an object of strings, got number" {
+		t.Fatalf("expected a metadata validation error, got %v", err)
+	}
+}
+
+func TestGetFields(t *testing.T) {
+	serverURL := "https://registry.example.com"
+	store := newMetadataStore()
+	store.AddWithMeta(&ExtendedCredentials{
+		Credentials: Credentials{ServerURL: serverURL, Username: "foo", Secret: "bar"},
+		Metadata:    map[string]string{"organization": "1234", "Secret": "shadowed"},
+	})
+
+	fields, err := GetFields(WithAliases(store, Aliases{}), serverURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{FieldUsername: "foo", FieldSecret: "bar", "organization": "1234"}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Fatalf("expected %v, got %v", expected, fields)
+	}
+
+	// Helpers without metadata only have the standard fields.
+	plain := newMemoryStore()
+	plain.Add(&Credentials{ServerURL: serverURL, Username: "foo", Secret: "bar"})
+	if fields, err = GetFields(plain, serverURL); err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) != 2 || fields[FieldUsername] != "foo" || fields[FieldSecret] != "bar" {
+		t.Fatalf("unexpected fields %v", fields)
+	}
+
+	if _, err := GetFields(plain, "https://quay.io"); !IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestAuthType(t *testing.T) {
+	cases := []struct {
+		name     string
+		in       string
+		username string
+	}{
+		{"token typed", `{"ServerURL": "https://index.docker.io/v1/", "Username": "foo", "Secret": "bar", "Metadata": {"AuthType": "identitytoken"}}`, IdentityTokenUsername},
+		{"token username", `{"ServerURL": "https://index.docker.io/v1/", "Username": "<token>", "Secret": "bar"}`, IdentityTokenUsername},
+		{"password typed", `{"ServerURL": "https://index.docker.io/v1/", "Username": "foo", "Secret": "bar", "Metadata": {"AuthType": "password"}}`, "foo"},
+		{"untyped", `{"ServerURL": "https://index.docker.io/v1/", "Username": "foo", "Secret": "bar"}`, "foo"},
+	}
+	for _, c := range cases {
+		h := newMetadataStore()
+		if err := Store(h, strings.NewReader(c.in)); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+
+		w := new(bytes.Buffer)
+		if err := Get(h, strings.NewReader("https://index.docker.io/v1/"), w); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		var resp Credentials
+		if err := json.NewDecoder(w).Decode(&resp); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if resp.Username != c.username || resp.Secret != "bar" {
+			t.Fatalf("%s: expected %s:bar, got %s:%s", c.name, c.username, resp.Username, resp.Secret)
+		}
+	}
+
+	in := strings.NewReader(`{"ServerURL": "https://index.docker.io/v1/", "Username": "foo", "Secret": "bar", "Metadata": {"AuthType": "bearer"}}`)
+	if err := Store(newMetadataStore(), in); err == nil || err.Error() != `invalid store request: unknown AuthType "bearer"` {
+		t.Fatalf("expected an unknown auth type error, got %v", err)
+	}
+}
+
+func TestCARef(t *testing.T) {
+	serverURL := "https://registry.example.com"
+	caRef := "/etc/docker/certs.d/registry.example.com/ca.crt"
+	store := newMetadataStore()
+	in := strings.NewReader(`{"ServerURL": "https://registry.example.com", "Username": "foo", "Secret": "bar", "Metadata": {"ca_ref": "` + caRef + `"}}`)
+	if err := Store(store, in); err != nil {
+		t.Fatal(err)
+	}
+
+	fields, err := GetFields(store, serverURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields[MetaCARef] != caRef {
+		t.Fatalf("expected the CA reference in the fields, got %v", fields)
+	}
+	c, err := GetWithMeta(store, serverURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Metadata[MetaCARef] != caRef || c.Username != "foo" || c.Secret != "bar" {
+		t.Fatalf("expected the CA reference with the credentials, got %+v", c)
+	}
+
+	// Clients reading the credentials only see the username and the secret.
+	w := new(bytes.Buffer)
+	if err := Get(store, strings.NewReader(serverURL), w); err != nil {
+		t.Fatal(err)
+	}
+	var resp Credentials
+	if err := json.NewDecoder(w).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp != (Credentials{ServerURL: serverURL, Username: "foo", Secret: "bar"}) {
+		t.Fatalf("unexpected credentials %+v", resp)
+	}
+}
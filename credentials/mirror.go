@@ -0,0 +1,119 @@
+package credentials
+
+import "fmt"
+
+// MirrorEnv is the environment variable naming a registered backend to which
+// ServeBackend mirrors the credentials it stores, with WithMirror.
+const MirrorEnv = "DOCKER_CREDS_MIRROR"
+
+// mirroredHelper copies the writes of a helper to a second one.
+type mirroredHelper struct {
+	decorator
+	mirror Helper
+}
+
+// WithMirror returns a helper storing credentials in both helper and mirror,
+// so that they can still be read from the mirror if helper later becomes
+// unreadable, for instance when a vault is lost.
+//
+// Add writes to helper first, and fails without writing to the mirror if
+// helper fails. Add also fails if the mirror fails, since the credentials
+// would otherwise not be recoverable, with an error telling that they were
+// stored in helper. Delete erases the credentials from both. Get prefers
+// helper, and only reads the mirror when helper does not hold the
+// credentials or fails with an error of kind ErrBackendUnavailable,
+// ErrTimeout or ErrNotInitialized. List merges both, helper winning, and
+// likewise only lists the mirror when helper fails with such an error. The
+// errors of the mirror are otherwise ignored by Get and List, so that an
+// unreachable mirror does not prevent reading the credentials of helper.
+func WithMirror(helper, mirror Helper) Helper {
+	return mirroredHelper{decorator: decorator{helper}, mirror: mirror}
+}
+
+func (h mirroredHelper) Add(creds *Credentials) error {
+	if err := h.Helper.Add(creds); err != nil {
+		return err
+	}
+	if err := h.mirror.Add(creds); err != nil {
+		return fmt.Errorf("credentials stored but not mirrored: %w", err)
+	}
+	return nil
+}
+
+func (h mirroredHelper) AddWithMeta(creds *ExtendedCredentials) error {
+	if err := AddWithMeta(h.Helper, creds); err != nil {
+		return err
+	}
+	if err := AddWithMeta(h.mirror, creds); err != nil {
+		return fmt.Errorf("credentials stored but not mirrored: %w", err)
+	}
+	return nil
+}
+
+// Delete erases the credentials from both helpers. It only reports missing
+// credentials when neither holds them.
+func (h mirroredHelper) Delete(serverURL string) error {
+	err := h.Helper.Delete(serverURL)
+	if err != nil && !IsErrCredentialsNotFound(err) {
+		return err
+	}
+	mirrorErr := h.mirror.Delete(serverURL)
+	if mirrorErr != nil && !IsErrCredentialsNotFound(mirrorErr) {
+		return fmt.Errorf("credentials erased but not from the mirror: %w", mirrorErr)
+	}
+	if err != nil && mirrorErr != nil {
+		return err
+	}
+	return nil
+}
+
+func (h mirroredHelper) Get(serverURL string) (string, string, error) {
+	return getCredentials(h.GetWithMeta(serverURL))
+}
+
+func (h mirroredHelper) GetWithMeta(serverURL string) (*ExtendedCredentials, error) {
+	creds, err := GetWithMeta(h.Helper, serverURL)
+	if err == nil || !IsErrCredentialsNotFound(err) && !unhealthy(err) {
+		return creds, err
+	}
+	mirrored, mirrorErr := GetWithMeta(h.mirror, serverURL)
+	if mirrorErr != nil {
+		return nil, err
+	}
+	return mirrored, nil
+}
+
+func (h mirroredHelper) List() (map[string]string, error) {
+	accts, err := h.Helper.List()
+	if err != nil && !unhealthy(err) {
+		return nil, err
+	}
+	mirrored, mirrorErr := h.mirror.List()
+	if mirrorErr != nil {
+		return accts, err
+	}
+	resp := map[string]string{}
+	for serverURL, username := range mirrored {
+		resp[serverURL] = username
+	}
+	for serverURL, username := range accts {
+		resp[serverURL] = username
+	}
+	return resp, nil
+}
+
+func (h mirroredHelper) ResolveBackend(serverURL string) (string, bool, error) {
+	_, err := GetWithMeta(h.Helper, serverURL)
+	if err == nil || !IsErrCredentialsNotFound(err) && !unhealthy(err) {
+		return Resolve(h.Helper, serverURL)
+	}
+	return Resolve(h.mirror, serverURL)
+}
+
+func (h mirroredHelper) Prefetch() error {
+	return chain{h.Helper, h.mirror}.Prefetch()
+}
+
+func (h mirroredHelper) Check() error {
+	return chain{h.Helper, h.mirror}.Check()
+}
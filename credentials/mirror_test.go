@@ -0,0 +1,147 @@
+package credentials
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// brokenStore is a memoryStore whose reads or writes fail.
+type brokenStore struct {
+	*memoryStore
+	readErr, writeErr error
+}
+
+func (b brokenStore) Add(creds *Credentials) error {
+	if b.writeErr != nil {
+		return b.writeErr
+	}
+	return b.memoryStore.Add(creds)
+}
+
+func (b brokenStore) Get(serverURL string) (string, string, error) {
+	if b.readErr != nil {
+		return "", "", b.readErr
+	}
+	return b.memoryStore.Get(serverURL)
+}
+
+func (b brokenStore) List() (map[string]string, error) {
+	if b.readErr != nil {
+		return nil, b.readErr
+	}
+	return b.memoryStore.List()
+}
+
+func TestWithMirror(t *testing.T) {
+	serverURL := "https://index.docker.io/v1/"
+	primary, mirror := newMemoryStore(), newMemoryStore()
+	h := WithMirror(primary, mirror)
+
+	if err := h.Add(&Credentials{ServerURL: serverURL, Username: "foo", Secret: "bar"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := primary.creds[serverURL]; !ok {
+		t.Fatal("expected the credentials to be stored in the primary helper")
+	}
+	if _, ok := mirror.creds[serverURL]; !ok {
+		t.Fatal("expected the credentials to be mirrored")
+	}
+
+	// Get prefers the primary helper.
+	mirror.Add(&Credentials{ServerURL: serverURL, Username: "foo", Secret: "stale"})
+	if _, secret, err := h.Get(serverURL); err != nil || secret != "bar" {
+		t.Fatalf("expected the secret of the primary helper, got %s, %v", secret, err)
+	}
+
+	// The mirror serves the credentials the primary helper lost.
+	delete(primary.creds, serverURL)
+	if _, secret, err := h.Get(serverURL); err != nil || secret != "stale" {
+		t.Fatalf("expected the secret of the mirror, got %s, %v", secret, err)
+	}
+
+	if err := h.Delete(serverURL); err != nil {
+		t.Fatal(err)
+	}
+	if len(primary.creds) != 0 || len(mirror.creds) != 0 {
+		t.Fatalf("expected the credentials to be erased from both helpers, got %v and %v", primary.creds, mirror.creds)
+	}
+}
+
+func TestWithMirrorFailures(t *testing.T) {
+	serverURL := "https://index.docker.io/v1/"
+	creds := &Credentials{ServerURL: serverURL, Username: "foo", Secret: "bar"}
+
+	// A failing primary helper fails the write before the mirror.
+	mirror := newMemoryStore()
+	h := WithMirror(brokenStore{memoryStore: newMemoryStore(), writeErr: errors.New("read-only")}, mirror)
+	if err := h.Add(creds); err == nil || err.Error() != "read-only" {
+		t.Fatalf("expected the error of the primary helper, got %v", err)
+	}
+	if len(mirror.creds) != 0 {
+		t.Fatal("expected nothing to be mirrored")
+	}
+
+	// A failing mirror fails the write, which is kept in the primary helper.
+	primary := newMemoryStore()
+	h = WithMirror(primary, brokenStore{memoryStore: newMemoryStore(), writeErr: errors.New("disk full")})
+	err := h.Add(creds)
+	if err == nil || !strings.HasPrefix(err.Error(), "credentials stored but not mirrored") {
+		t.Fatalf("expected a mirror error, got %v", err)
+	}
+	if _, ok := primary.creds[serverURL]; !ok {
+		t.Fatal("expected the credentials to be kept in the primary helper")
+	}
+
+	// An unreadable primary helper falls back to the mirror.
+	mirror = newMemoryStore()
+	mirror.Add(creds)
+	unreadable := brokenStore{memoryStore: newMemoryStore(), readErr: NewBackendError(ErrBackendUnavailable, errors.New("vault sealed"))}
+	if _, secret, err := WithMirror(unreadable, mirror).Get(serverURL); err != nil || secret != "bar" {
+		t.Fatalf("expected the secret of the mirror, got %s, %v", secret, err)
+	}
+
+	// Other errors of the primary helper are returned.
+	denied := brokenStore{memoryStore: newMemoryStore(), readErr: NewBackendError(ErrPermissionDenied, errors.New("invalid token"))}
+	if _, _, err := WithMirror(denied, mirror).Get(serverURL); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("expected a permission denied error, got %v", err)
+	}
+}
+
+func TestWithMirrorList(t *testing.T) {
+	primary := newMemoryStore()
+	primary.Add(&Credentials{ServerURL: "https://index.docker.io/v1/", Username: "foo", Secret: "bar"})
+	mirror := newMemoryStore()
+	mirror.Add(&Credentials{ServerURL: "https://index.docker.io/v1/", Username: "old", Secret: "bar"})
+	mirror.Add(&Credentials{ServerURL: "https://quay.io", Username: "baz", Secret: "qux"})
+
+	accts, err := WithMirror(primary, mirror).List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accts) != 2 || accts["https://index.docker.io/v1/"] != "foo" || accts["https://quay.io"] != "baz" {
+		t.Fatalf("expected both helpers to be listed, the primary one winning, got %v", accts)
+	}
+
+	// An unreachable mirror is ignored.
+	unreachable := brokenStore{memoryStore: newMemoryStore(), readErr: NewBackendError(ErrBackendUnavailable, errors.New("connection refused"))}
+	accts, err = WithMirror(primary, unreachable).List()
+	if err != nil {
+		t.Fatalf("expected the errors of the mirror to be ignored, got %v", err)
+	}
+	if len(accts) != 1 || accts["https://index.docker.io/v1/"] != "foo" {
+		t.Fatalf("expected the credentials of the primary helper, got %v", accts)
+	}
+
+	// An unreachable primary helper falls back to the mirror.
+	accts, err = WithMirror(unreachable, mirror).List()
+	if err != nil || len(accts) != 2 || accts["https://index.docker.io/v1/"] != "old" {
+		t.Fatalf("expected the credentials of the mirror, got %v, %v", accts, err)
+	}
+
+	// Other errors of the primary helper are returned.
+	denied := brokenStore{memoryStore: newMemoryStore(), readErr: NewBackendError(ErrPermissionDenied, errors.New("invalid token"))}
+	if _, err := WithMirror(denied, mirror).List(); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("expected a permission denied error, got %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package credentials
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker-credential-helpers/registryurl"
+)
+
+// netrcSafe reports whether a value can be written as a netrc token, which
+// ends at the first whitespace and cannot be quoted portably.
+func netrcSafe(value string) bool {
+	return value != "" && !strings.ContainsAny(value, " \t\r\n\v\f") && !strings.HasPrefix(value, "#")
+}
+
+// ExportNetrc writes the credentials of every server URL listed by a helper
+// in the netrc format, one "machine <host> login <username> password
+// <secret>" line per host, for tools reading ~/.netrc such as curl and git.
+// netrc machines are host names which do not hold ports, so the port of a
+// server URL is dropped, and when several server URLs share a host, the
+// first in lexical order wins. Identity tokens are skipped, since they are
+// not passwords, and so are anonymous credentials, which tools reading netrc
+// use when a host has no entry. Wildcard entries, such as *.example.com, are
+// skipped as well, since netrc machines are matched exactly.
+//
+// The secrets are written as is to the writer, which the caller should save
+// with restricted permissions. Credentials holding whitespace cannot be
+// represented in netrc and are reported as an error before anything is
+// written.
+func ExportNetrc(helper Helper, writer io.Writer) error {
+	accts, err := helper.List()
+	if err != nil {
+		return err
+	}
+	serverURLs := make([]string, 0, len(accts))
+	for serverURL := range accts {
+		serverURLs = append(serverURLs, serverURL)
+	}
+	sort.Strings(serverURLs)
+
+	buffer := new(bytes.Buffer)
+	defer func() { zero(buffer.Bytes()) }()
+	machines := map[string]bool{}
+	for _, serverURL := range serverURLs {
+		u, err := registryurl.Parse(serverURL)
+		if err != nil {
+			continue
+		}
+		host := u.Hostname()
+		if isHostPattern(host) || machines[host] {
+			continue
+		}
+		creds, err := GetWithMeta(helper, serverURL)
+		if IsErrCredentialsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		applyAuthType(creds)
+		if creds.Username == IdentityTokenUsername || creds.IsAnonymous() {
+			continue
+		}
+		if !netrcSafe(host) || !netrcSafe(creds.Username) || !netrcSafe(creds.Secret) {
+			return fmt.Errorf("the credentials stored for %s cannot be written as netrc", serverURL)
+		}
+		machines[host] = true
+		fmt.Fprintf(buffer, "machine %s login %s password %s\n", host, creds.Username, creds.Secret)
+	}
+
+	_, err = writer.Write(buffer.Bytes())
+	return err
+}
@@ -0,0 +1,64 @@
+package credentials
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parseNetrc parses machine entries the way netrc readers do, returning the
+// login and password of each machine.
+func parseNetrc(t *testing.T, data string) map[string][2]string {
+	t.Helper()
+	machines := map[string][2]string{}
+	tokens := strings.Fields(data)
+	for i := 0; i < len(tokens); i += 6 {
+		if i+6 > len(tokens) || tokens[i] != "machine" || tokens[i+2] != "login" || tokens[i+4] != "password" {
+			t.Fatalf("unexpected netrc entry at token %d of %q", i, data)
+		}
+		if _, ok := machines[tokens[i+1]]; ok {
+			t.Fatalf("duplicate machine %s in %q", tokens[i+1], data)
+		}
+		machines[tokens[i+1]] = [2]string{tokens[i+3], tokens[i+5]}
+	}
+	return machines
+}
+
+func TestExportNetrc(t *testing.T) {
+	h := newMetadataStore()
+	h.Add(&Credentials{ServerURL: "https://index.docker.io/v1/", Username: "foo", Secret: "bar"})
+	h.Add(&Credentials{ServerURL: "registry.example.com:5000", Username: "ci", Secret: "s3cret"})
+	h.Add(&Credentials{ServerURL: "https://registry.example.com", Username: "other", Secret: "baz"})
+	h.Add(&Credentials{ServerURL: "https://anonymous.example.com"})
+	h.Add(&Credentials{ServerURL: "ghcr.io", Username: "ci", Secret: "pat"})
+	h.Add(&Credentials{ServerURL: "https://*.example.com", Username: "wild", Secret: "card"})
+	h.Add(&Credentials{ServerURL: "https://*.corp.example:5000", Username: "wild", Secret: "card"})
+	h.AddWithMeta(&ExtendedCredentials{
+		Credentials: Credentials{ServerURL: "quay.io", Username: "robot", Secret: "token"},
+		Metadata:    map[string]string{MetaAuthType: AuthTypeIdentityToken},
+	})
+
+	w := new(bytes.Buffer)
+	if err := HandleCommand(h, "netrc", strings.NewReader(""), w); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][2]string{
+		"index.docker.io":      {"foo", "bar"},
+		"registry.example.com": {"other", "baz"},
+		"ghcr.io":              {"ci", "pat"},
+	}
+	if got := parseNetrc(t, w.String()); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	h.Add(&Credentials{ServerURL: "ghcr.io", Username: "foo", Secret: "two words"})
+	w.Reset()
+	err := ExportNetrc(h, w)
+	if err == nil || err.Error() != "the credentials stored for ghcr.io cannot be written as netrc" {
+		t.Fatalf("expected an unrepresentable secret to be rejected, got %v", err)
+	}
+	if w.Len() != 0 {
+		t.Fatalf("expected no output, got %q", w.String())
+	}
+}
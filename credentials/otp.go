@@ -0,0 +1,65 @@
+package credentials
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MetaTOTPSeed is the metadata key of the base32 encoded TOTP seed of
+// registries expecting a one-time password along with the secret, such as
+// logins behind some corporate proxies. GetOTP generates the current code.
+const MetaTOTPSeed = "totp_seed"
+
+// otpNow returns the time of the codes generated by GetOTP.
+var otpNow = time.Now
+
+// GetOTP returns the current time-based one-time password (RFC 6238) of the
+// credentials of a server URL, generated from the seed stored in their
+// MetaTOTPSeed metadata: a 6 digits code, renewed every 30 seconds. It does
+// not change the credentials returned by get, so tools needing the code
+// must assemble it with the secret themselves.
+func GetOTP(helper Helper, serverURL string) (string, error) {
+	creds, err := GetWithMeta(helper, serverURL)
+	if err != nil {
+		return "", err
+	}
+	seed, ok := creds.Metadata[MetaTOTPSeed]
+	if !ok {
+		return "", fmt.Errorf("no TOTP seed stored for %s", serverURL)
+	}
+	code, err := totp(seed, otpNow())
+	if err != nil {
+		// The error must not include the seed.
+		return "", fmt.Errorf("invalid TOTP seed stored for %s: %v", serverURL, err)
+	}
+	return code, nil
+}
+
+// totp computes the 6 digits TOTP code of a base32 encoded seed at t, with a
+// 30 seconds period and HMAC-SHA1.
+func totp(seed string, t time.Time) (string, error) {
+	seed = strings.ToUpper(strings.Replace(seed, " ", "", -1))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(seed, "="))
+	if err != nil {
+		return "", errors.New("not a base32 encoded key")
+	}
+	if len(key) == 0 {
+		return "", errors.New("empty key")
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000), nil
+}
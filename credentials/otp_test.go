@@ -0,0 +1,78 @@
+package credentials
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Seed is the base32 encoding of the SHA1 seed of the test vectors
+// of RFC 6238, "12345678901234567890".
+const rfc6238Seed = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTP(t *testing.T) {
+	// The 6 last digits of the 8 digits codes of RFC 6238.
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, te := range tests {
+		code, err := totp(rfc6238Seed, time.Unix(te.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != te.code {
+			t.Errorf("expected %s at %d, got %s", te.code, te.unix, code)
+		}
+	}
+
+	// Seeds are often written in lower case groups with padding.
+	if code, _ := totp("gezd gnbv gy3t qojq gezd gnbv gy3t qojq====", time.Unix(59, 0)); code != "287082" {
+		t.Fatalf("expected the formatted seed to be accepted, got %s", code)
+	}
+}
+
+func TestGetOTP(t *testing.T) {
+	defer func() { otpNow = time.Now }()
+	otpNow = func() time.Time { return time.Unix(59, 0) }
+
+	serverURL := "https://registry.example.com"
+	store := newMetadataStore()
+	store.AddWithMeta(&ExtendedCredentials{
+		Credentials: Credentials{ServerURL: serverURL, Username: "foo", Secret: "bar"},
+		Metadata:    map[string]string{MetaTOTPSeed: rfc6238Seed},
+	})
+
+	code, err := GetOTP(store, serverURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "287082" {
+		t.Fatalf("expected 287082, got %s", code)
+	}
+
+	store.AddWithMeta(&ExtendedCredentials{
+		Credentials: Credentials{ServerURL: serverURL, Username: "foo", Secret: "bar"},
+		Metadata:    map[string]string{MetaTOTPSeed: "not-base32!"},
+	})
+	_, err = GetOTP(store, serverURL)
+	if err == nil || strings.Contains(err.Error(), "not-base32!") {
+		t.Fatalf("expected an invalid seed error without the seed, got %v", err)
+	}
+
+	plain := newMemoryStore()
+	plain.Add(&Credentials{ServerURL: serverURL, Username: "foo", Secret: "bar"})
+	if _, err := GetOTP(plain, serverURL); err == nil || err.Error() != "no TOTP seed stored for https://registry.example.com" {
+		t.Fatalf("expected a missing seed error, got %v", err)
+	}
+	if _, err := GetOTP(plain, "https://quay.io"); !IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
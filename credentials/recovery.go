@@ -0,0 +1,168 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// maxRecoveryBackoff bounds the backoff of WithRecovery, as a multiple of
+// its initial backoff.
+const maxRecoveryBackoff = 32
+
+// recoveringHelper recreates its helper when its backend becomes unhealthy.
+type recoveringHelper struct {
+	factory Factory
+	backoff time.Duration
+	now     func() time.Time
+
+	mu     sync.Mutex
+	helper Helper
+	// generation identifies the helper instance, so that late failures of
+	// the instances it replaced do not drop it.
+	generation int
+	failures   int
+	retryAt    time.Time
+	lastErr    error
+}
+
+// WithRecovery returns a helper created lazily with factory, and created
+// again when an operation fails with an error of kind ErrBackendUnavailable,
+// ErrTimeout or ErrNotInitialized, such as a dropped connection or an expired
+// session. The failed operation returns its error, and the helper is created
+// again by the next operation. Operations arriving within backoff of the
+// failure fail right away with the same error. The backoff doubles with each
+// consecutive failure, up to 32 times its initial value.
+//
+// It is meant for programs serving many requests with the same helper, which
+// would otherwise keep failing until they are restarted. Serve handles a
+// single request and does not use it.
+func WithRecovery(factory Factory, backoff time.Duration) Helper {
+	return &recoveringHelper{factory: factory, backoff: backoff, now: time.Now}
+}
+
+// unhealthy reports whether an error calls for creating the helper again.
+func unhealthy(err error) bool {
+	return errors.Is(err, ErrBackendUnavailable) || errors.Is(err, ErrTimeout) || errors.Is(err, ErrNotInitialized)
+}
+
+// current returns the helper, creating it if needed, and its generation.
+func (h *recoveringHelper) current() (Helper, int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.helper != nil {
+		return h.helper, h.generation, nil
+	}
+	if h.failures > 0 && h.now().Before(h.retryAt) {
+		return nil, 0, h.lastErr
+	}
+	helper, err := h.factory()
+	if err != nil {
+		h.fail(fmt.Errorf("creating the credentials helper: %w", err))
+		return nil, 0, h.lastErr
+	}
+	h.helper = helper
+	return helper, h.generation, nil
+}
+
+// done records the outcome of an operation run by the helper of a
+// generation. Outcomes of the helpers replaced since are ignored.
+func (h *recoveringHelper) done(generation int, err error) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if generation != h.generation {
+		return err
+	}
+	if err == nil || !unhealthy(err) {
+		h.failures = 0
+		return err
+	}
+	h.fail(err)
+	return err
+}
+
+// fail marks the helper unhealthy, ending its generation. h.mu must be
+// held.
+func (h *recoveringHelper) fail(err error) {
+	h.helper = nil
+	h.generation++
+	h.lastErr = err
+	h.failures++
+	backoff := h.backoff
+	for i := 1; i < h.failures && backoff < maxRecoveryBackoff*h.backoff; i++ {
+		backoff *= 2
+	}
+	h.retryAt = h.now().Add(backoff)
+}
+
+func (h *recoveringHelper) Add(creds *Credentials) error {
+	helper, generation, err := h.current()
+	if err != nil {
+		return err
+	}
+	return h.done(generation, helper.Add(creds))
+}
+
+func (h *recoveringHelper) AddWithMeta(creds *ExtendedCredentials) error {
+	helper, generation, err := h.current()
+	if err != nil {
+		return err
+	}
+	return h.done(generation, AddWithMeta(helper, creds))
+}
+
+func (h *recoveringHelper) Delete(serverURL string) error {
+	helper, generation, err := h.current()
+	if err != nil {
+		return err
+	}
+	return h.done(generation, helper.Delete(serverURL))
+}
+
+func (h *recoveringHelper) Get(serverURL string) (string, string, error) {
+	return getCredentials(h.GetWithMeta(serverURL))
+}
+
+func (h *recoveringHelper) GetWithMeta(serverURL string) (*ExtendedCredentials, error) {
+	helper, generation, err := h.current()
+	if err != nil {
+		return nil, err
+	}
+	creds, err := GetWithMeta(helper, serverURL)
+	return creds, h.done(generation, err)
+}
+
+func (h *recoveringHelper) List() (map[string]string, error) {
+	helper, generation, err := h.current()
+	if err != nil {
+		return nil, err
+	}
+	accts, err := helper.List()
+	return accts, h.done(generation, err)
+}
+
+func (h *recoveringHelper) ResolveBackend(serverURL string) (string, bool, error) {
+	helper, generation, err := h.current()
+	if err != nil {
+		return "", false, err
+	}
+	name, found, err := Resolve(helper, serverURL)
+	return name, found, h.done(generation, err)
+}
+
+func (h *recoveringHelper) Prefetch() error {
+	helper, generation, err := h.current()
+	if err != nil {
+		return err
+	}
+	return h.done(generation, Prefetch(helper))
+}
+
+func (h *recoveringHelper) Check() error {
+	helper, generation, err := h.current()
+	if err != nil {
+		return err
+	}
+	return h.done(generation, Check(helper))
+}
@@ -0,0 +1,126 @@
+package credentials
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// flakyStore is a memoryStore whose backend can go down.
+type flakyStore struct {
+	*memoryStore
+	down *bool
+}
+
+func (f flakyStore) Get(serverURL string) (string, string, error) {
+	if *f.down {
+		return "", "", NewBackendError(ErrBackendUnavailable, errors.New("connection reset"))
+	}
+	return f.memoryStore.Get(serverURL)
+}
+
+func TestWithRecovery(t *testing.T) {
+	serverURL := "https://index.docker.io/v1/"
+	down := false
+	created := 0
+	factory := func() (Helper, error) {
+		created++
+		store := newMemoryStore()
+		store.Add(&Credentials{ServerURL: serverURL, Username: "foo", Secret: "bar"})
+		return flakyStore{memoryStore: store, down: &down}, nil
+	}
+
+	now := time.Unix(0, 0)
+	h := WithRecovery(factory, time.Second)
+	h.(*recoveringHelper).now = func() time.Time { return now }
+
+	if _, _, err := h.Get(serverURL); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := h.Get(serverURL); err != nil || created != 1 {
+		t.Fatalf("expected the helper to be reused, created %d times, %v", created, err)
+	}
+
+	// Missing credentials do not make the backend unhealthy.
+	if _, _, err := h.Get("https://quay.io"); !IsErrCredentialsNotFound(err) || created != 1 {
+		t.Fatalf("expected not found from the same helper, created %d times, %v", created, err)
+	}
+
+	down = true
+	if _, _, err := h.Get(serverURL); !errors.Is(err, ErrBackendUnavailable) {
+		t.Fatalf("expected the induced failure, got %v", err)
+	}
+	down = false
+
+	// Requests within the backoff fail without creating the helper again.
+	if _, _, err := h.Get(serverURL); !errors.Is(err, ErrBackendUnavailable) || created != 1 {
+		t.Fatalf("expected the request to fail within the backoff, created %d times, %v", created, err)
+	}
+
+	now = now.Add(time.Second)
+	if _, _, err := h.Get(serverURL); err != nil {
+		t.Fatalf("expected the helper to recover, got %v", err)
+	}
+	if created != 2 {
+		t.Fatalf("expected the helper to be created again, created %d times", created)
+	}
+}
+
+func TestWithRecoveryBackoff(t *testing.T) {
+	attempts := 0
+	factory := func() (Helper, error) {
+		attempts++
+		return nil, NewBackendError(ErrNotInitialized, errors.New("store not initialized"))
+	}
+
+	now := time.Unix(0, 0)
+	h := WithRecovery(factory, time.Second)
+	rh := h.(*recoveringHelper)
+	rh.now = func() time.Time { return now }
+
+	for i, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		if _, err := h.List(); !errors.Is(err, ErrNotInitialized) {
+			t.Fatalf("expected the creation error, got %v", err)
+		}
+		if attempts != i+1 {
+			t.Fatalf("expected %d attempts, got %d", i+1, attempts)
+		}
+		if backoff := rh.retryAt.Sub(now); backoff != expected {
+			t.Fatalf("expected a backoff of %v, got %v", expected, backoff)
+		}
+		now = rh.retryAt
+	}
+}
+
+func TestWithRecoveryLateFailure(t *testing.T) {
+	created := 0
+	factory := func() (Helper, error) {
+		created++
+		return newMemoryStore(), nil
+	}
+
+	now := time.Unix(0, 0)
+	h := WithRecovery(factory, time.Second)
+	rh := h.(*recoveringHelper)
+	rh.now = func() time.Time { return now }
+
+	// Two operations run concurrently on the first helper, and both fail.
+	_, first, err := rh.current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unavailable := NewBackendError(ErrBackendUnavailable, errors.New("connection reset"))
+	rh.done(first, unavailable)
+
+	now = now.Add(time.Second)
+	if _, err := h.List(); err != nil || created != 2 {
+		t.Fatalf("expected the helper to be created again, created %d times, %v", created, err)
+	}
+	// The late failure of the first helper must not drop its replacement.
+	if err := rh.done(first, unavailable); err != unavailable {
+		t.Fatalf("expected the late failure to be returned, got %v", err)
+	}
+	if _, err := h.List(); err != nil || created != 2 {
+		t.Fatalf("expected the replacement helper to be kept, created %d times, %v", created, err)
+	}
+}
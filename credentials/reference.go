@@ -0,0 +1,109 @@
+package credentials
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ReferencePrefix starts the secrets which are references to a secret kept
+// in another manager.
+const ReferencePrefix = "ref://"
+
+// Reference identifies a secret kept in another manager. Its text form is
+//
+//	ref://<manager>/<path>[#<field>]
+//
+// for instance ref://vault/secret/docker/hub#password designates the
+// password field of the secret/docker/hub entry of the manager registered as
+// "vault". The meaning of the path and of the field is left to the resolver
+// of the manager.
+type Reference struct {
+	Manager string
+	Path    string
+	Field   string
+}
+
+// String returns the text form of the reference.
+func (r Reference) String() string {
+	s := ReferencePrefix + r.Manager + "/" + r.Path
+	if r.Field != "" {
+		s += "#" + r.Field
+	}
+	return s
+}
+
+// IsReference returns whether a secret is a reference.
+func IsReference(secret string) bool {
+	return strings.HasPrefix(secret, ReferencePrefix)
+}
+
+// ParseReference parses the text form of a reference.
+func ParseReference(s string) (Reference, error) {
+	if !IsReference(s) {
+		return Reference{}, fmt.Errorf("invalid secret reference, expected %s<manager>/<path>", ReferencePrefix)
+	}
+	rest := strings.TrimPrefix(s, ReferencePrefix)
+
+	var ref Reference
+	if i := strings.Index(rest, "#"); i >= 0 {
+		rest, ref.Field = rest[:i], rest[i+1:]
+	}
+	i := strings.Index(rest, "/")
+	if i <= 0 || i == len(rest)-1 {
+		return Reference{}, fmt.Errorf("invalid secret reference, expected %s<manager>/<path>", ReferencePrefix)
+	}
+	ref.Manager, ref.Path = rest[:i], rest[i+1:]
+	return ref, nil
+}
+
+// Resolver dereferences the references to the secrets of a manager.
+type Resolver interface {
+	Resolve(ref Reference) (string, error)
+}
+
+// ResolverFunc adapts a function to a Resolver.
+type ResolverFunc func(ref Reference) (string, error)
+
+// Resolve calls f.
+func (f ResolverFunc) Resolve(ref Reference) (string, error) {
+	return f(ref)
+}
+
+// References is a Transformer dereferencing the secrets which are
+// references, with the resolver registered for the manager they designate.
+// Plain secrets are left unchanged, and references are stored as they are,
+// so a store only has to hold them. Use it with WithTransforms:
+//
+//	helper = credentials.WithTransforms(helper, credentials.References{"vault": resolver})
+type References map[string]Resolver
+
+// TransformGet replaces a reference by the secret it designates.
+func (r References) TransformGet(creds *Credentials) error {
+	if !IsReference(creds.Secret) {
+		return nil
+	}
+	ref, err := ParseReference(creds.Secret)
+	if err != nil {
+		return err
+	}
+	resolver, ok := r[ref.Manager]
+	if !ok {
+		return fmt.Errorf("no resolver for the secret references of manager %q", ref.Manager)
+	}
+	secret, err := resolver.Resolve(ref)
+	if err != nil {
+		return fmt.Errorf("resolving secret reference %s: %v", ref, err)
+	}
+	creds.Secret = secret
+	return nil
+}
+
+// TransformAdd checks that references are well formed, and otherwise
+// leaves the credentials unchanged.
+func (r References) TransformAdd(creds *Credentials) error {
+	if IsReference(creds.Secret) {
+		_, err := ParseReference(creds.Secret)
+		return err
+	}
+	return nil
+}
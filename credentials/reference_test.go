@@ -0,0 +1,92 @@
+package credentials
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	valid := []struct {
+		in  string
+		ref Reference
+	}{
+		{"ref://vault/secret/docker/hub#password", Reference{Manager: "vault", Path: "secret/docker/hub", Field: "password"}},
+		{"ref://op/Private/Docker Hub", Reference{Manager: "op", Path: "Private/Docker Hub"}},
+	}
+	for _, c := range valid {
+		ref, err := ParseReference(c.in)
+		if err != nil {
+			t.Fatalf("%s: %v", c.in, err)
+		}
+		if ref != c.ref {
+			t.Fatalf("%s: expected %+v, got %+v", c.in, c.ref, ref)
+		}
+		if ref.String() != c.in {
+			t.Fatalf("expected %s, got %s", c.in, ref)
+		}
+	}
+
+	for _, in := range []string{"hunter2", "ref://", "ref://vault", "ref://vault/", "ref:///secret#password"} {
+		if _, err := ParseReference(in); err == nil {
+			t.Fatalf("expected %q to be rejected", in)
+		}
+	}
+}
+
+func TestReferences(t *testing.T) {
+	store := newMemoryStore()
+	var resolved []Reference
+	h := WithTransforms(store, References{
+		"vault": ResolverFunc(func(ref Reference) (string, error) {
+			resolved = append(resolved, ref)
+			if ref.Path != "secret/docker/hub" {
+				return "", errors.New("no such secret")
+			}
+			return "s3cr3t", nil
+		}),
+	})
+
+	add := func(serverURL, secret string) {
+		if err := h.Add(&Credentials{ServerURL: serverURL, Username: "foo", Secret: secret}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add("https://index.docker.io/v1/", "ref://vault/secret/docker/hub#password")
+	add("https://quay.io", "hunter2")
+	add("https://ghcr.io", "ref://vault/secret/docker/ghcr")
+	add("https://gcr.io", "ref://keychain/docker")
+
+	if got := store.creds["https://index.docker.io/v1/"].Secret; got != "ref://vault/secret/docker/hub#password" {
+		t.Fatalf("expected the reference to be stored, got %s", got)
+	}
+
+	_, secret, err := h.Get("https://index.docker.io/v1/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret != "s3cr3t" {
+		t.Fatalf("expected the dereferenced secret, got %s", secret)
+	}
+	if len(resolved) != 1 || resolved[0].Field != "password" {
+		t.Fatalf("expected the reference to be resolved once, got %v", resolved)
+	}
+
+	_, secret, err = h.Get("https://quay.io")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret != "hunter2" || len(resolved) != 1 {
+		t.Fatalf("expected the plain secret to pass through, got %s", secret)
+	}
+
+	if _, _, err := h.Get("https://ghcr.io"); err == nil || err.Error() != "resolving secret reference ref://vault/secret/docker/ghcr: no such secret" {
+		t.Fatalf("expected the resolver error, got %v", err)
+	}
+	if _, _, err := h.Get("https://gcr.io"); err == nil || err.Error() != `no resolver for the secret references of manager "keychain"` {
+		t.Fatalf("expected an unknown manager error, got %v", err)
+	}
+
+	if err := h.Add(&Credentials{ServerURL: "https://gcr.io", Username: "foo", Secret: "ref://vault"}); err == nil {
+		t.Fatal("expected a malformed reference to be rejected")
+	}
+}
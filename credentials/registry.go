@@ -0,0 +1,173 @@
+package credentials
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// BackendEnv is the environment variable used by ServeBackend to select the
+// backend to serve when no --backend flag is given.
+const BackendEnv = "DOCKER_CREDS_BACKEND"
+
+// Factory creates the helper of a registered backend.
+type Factory func() (Helper, error)
+
+var (
+	backendsMutex sync.RWMutex
+	backends      = make(map[string]Factory)
+)
+
+// Register makes a backend available by the provided name, so that a single
+// program can serve several credentials stores.
+// If Register is called twice with the same name or if factory is nil, it panics.
+func Register(name string, factory Factory) {
+	backendsMutex.Lock()
+	defer backendsMutex.Unlock()
+	if factory == nil {
+		panic("credentials: Register factory is nil")
+	}
+	if _, dup := backends[name]; dup {
+		panic("credentials: Register called twice for backend " + name)
+	}
+	backends[name] = factory
+}
+
+// unregister removes backends, so that tests can register them again.
+func unregister(names ...string) {
+	backendsMutex.Lock()
+	defer backendsMutex.Unlock()
+	for _, name := range names {
+		delete(backends, name)
+	}
+}
+
+// Backends returns a sorted list of the names of the registered backends.
+func Backends() []string {
+	backendsMutex.RLock()
+	defer backendsMutex.RUnlock()
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewBackend creates the helper of the backend registered by the provided name.
+func NewBackend(name string) (Helper, error) {
+	backendsMutex.RLock()
+	factory, ok := backends[name]
+	backendsMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("Unknown credentials backend `%s`, available backends: %s", name, strings.Join(Backends(), ", "))
+	}
+	return factory()
+}
+
+// newChain creates the helpers of the named backends. A single backend is
+// not chained.
+func newChain(names []string) (Helper, error) {
+	helpers := make([]Helper, len(names))
+	for i, name := range names {
+		name = strings.TrimSpace(name)
+		helper, err := NewBackend(name)
+		if err != nil {
+			return nil, err
+		}
+		helpers[i] = Named(name, helper)
+	}
+	if len(helpers) == 1 {
+		return helpers[0], nil
+	}
+	return Chain(helpers...), nil
+}
+
+// newMirror mirrors the writes of a helper to the named backend.
+func newMirror(helper Helper, name string) (Helper, error) {
+	mirror, err := NewBackend(name)
+	if err != nil {
+		return nil, err
+	}
+	return WithMirror(helper, Named(name, mirror)), nil
+}
+
+// selectBackend extracts the backend name from a --backend flag in args,
+// falling back to the provided default. It returns the remaining arguments.
+func selectBackend(args []string, def string) (string, []string, error) {
+	name := def
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--backend" || arg == "-backend":
+			if i+1 == len(args) {
+				return "", nil, fmt.Errorf("missing value for %s", arg)
+			}
+			i++
+			name = args[i]
+		case strings.HasPrefix(arg, "--backend="):
+			name = strings.TrimPrefix(arg, "--backend=")
+		case strings.HasPrefix(arg, "-backend="):
+			name = strings.TrimPrefix(arg, "-backend=")
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	if name == "" {
+		return "", nil, fmt.Errorf("no credentials backend selected, use --backend or %s", BackendEnv)
+	}
+	return name, rest, nil
+}
+
+// ServeBackend works like Serve for the registered backend selected with the
+// --backend flag or the DOCKER_CREDS_BACKEND environment variable.
+// A comma separated list of backends selects a Chain of these backends.
+// The writes are mirrored to the backend named by MirrorEnv, if any.
+// When ComposeEnv is set, the helper it describes is served instead, see
+// Compose.
+// This function terminates the program with os.Exit(1) if there is an error.
+func ServeBackend() {
+	var helper Helper
+	var err error
+	args := os.Args[1:]
+	if os.Getenv(ComposeEnv) != "" {
+		if !validArgs(args) {
+			err = fmt.Errorf("Usage: %s %s", os.Args[0], usage)
+		}
+		if err == nil {
+			helper, err = composeFromEnv()
+		}
+	} else {
+		var name string
+		name, args, err = selectBackend(args, os.Getenv(BackendEnv))
+		if err == nil && !validArgs(args) {
+			err = fmt.Errorf("Usage: %s [--backend <%s>] %s", os.Args[0], strings.Join(Backends(), "|"), usage)
+		}
+
+		if err == nil {
+			helper, err = newChain(strings.Split(name, ","))
+		}
+	}
+
+	if mirror := os.Getenv(MirrorEnv); err == nil && mirror != "" {
+		helper, err = newMirror(helper, mirror)
+	}
+
+	if err == nil {
+		helper, err = configure(helper)
+	}
+
+	if err == nil {
+		err = serveInterruptible(func() error {
+			return handleArgs(helper, args, os.Stdin, os.Stdout)
+		})
+	}
+
+	if err != nil {
+		reportError(os.Stdout, err)
+		os.Exit(1)
+	}
+}
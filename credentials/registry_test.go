@@ -0,0 +1,85 @@
+package credentials
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRegisterBackend(t *testing.T) {
+	store := newMemoryStore()
+	Register("test-registry-memory", func() (Helper, error) { return store, nil })
+	defer unregister("test-registry-memory")
+
+	found := false
+	for _, name := range Backends() {
+		if name == "test-registry-memory" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected test-registry-memory in %v", Backends())
+	}
+
+	h, err := NewBackend("test-registry-memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h != store {
+		t.Fatal("expected the helper created by the registered factory")
+	}
+}
+
+func TestRegisterBackendTwice(t *testing.T) {
+	factory := func() (Helper, error) { return newMemoryStore(), nil }
+	Register("test-registry-twice", factory)
+	defer unregister("test-registry-twice")
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected Register to panic for a duplicate backend")
+		}
+	}()
+	Register("test-registry-twice", factory)
+}
+
+func TestNewBackendUnknown(t *testing.T) {
+	_, err := NewBackend("test-registry-unknown")
+	if err == nil || !strings.Contains(err.Error(), "Unknown credentials backend `test-registry-unknown`") {
+		t.Fatalf("expected unknown backend error, got %v", err)
+	}
+}
+
+func TestSelectBackend(t *testing.T) {
+	tests := []struct {
+		args []string
+		def  string
+		name string
+		rest []string
+		err  string
+	}{
+		{args: []string{"get"}, def: "pass", name: "pass", rest: []string{"get"}},
+		{args: []string{"--backend", "opconnect", "get"}, def: "pass", name: "opconnect", rest: []string{"get"}},
+		{args: []string{"--backend=opconnect", "list"}, name: "opconnect", rest: []string{"list"}},
+		{args: []string{"store", "-backend=pass"}, name: "pass", rest: []string{"store"}},
+		{args: []string{"get"}, err: "no credentials backend selected"},
+		{args: []string{"get", "--backend"}, err: "missing value for --backend"},
+	}
+
+	for _, te := range tests {
+		name, rest, err := selectBackend(te.args, te.def)
+		if te.err != "" {
+			if err == nil || !strings.Contains(err.Error(), te.err) {
+				t.Errorf("expected error %q for %v, got %v", te.err, te.args, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for %v: %v", te.args, err)
+			continue
+		}
+		if name != te.name || !reflect.DeepEqual(rest, te.rest) {
+			t.Errorf("expected %s %v for %v, got %s %v", te.name, te.rest, te.args, name, rest)
+		}
+	}
+}
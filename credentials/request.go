@@ -0,0 +1,114 @@
+package credentials
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// MaxRequestSize is the maximum size, in bytes, of the request read by an
+// action on its input. Larger requests are rejected without being read
+// entirely, so that a faulty client cannot exhaust the memory of the helper.
+var MaxRequestSize int64 = 1 << 20
+
+// readRequest reads the whole request sent to an action on its input.
+func readRequest(reader io.Reader) ([]byte, error) {
+	payload, err := ioutil.ReadAll(io.LimitReader(reader, MaxRequestSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(payload)) > MaxRequestSize {
+		zero(payload)
+		return nil, fmt.Errorf("request too large: exceeds %d bytes", MaxRequestSize)
+	}
+	return payload, nil
+}
+
+// decodeStoreRequest decodes and validates the payload of a store request.
+// Besides the required fields, it rejects unknown fields, fields which are
+// not strings and data following the credentials, reporting the offending
+// field so that integrators can tell why a request was refused. The optional
+// Metadata object holds the metadata of the credentials.
+func decodeStoreRequest(payload []byte) (*ExtendedCredentials, error) {
+	var creds ExtendedCredentials
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&creds); err != nil {
+		return nil, storeDecodeError(err)
+	}
+	if dec.More() {
+		return nil, errors.New("invalid store request: unexpected data after the credentials")
+	}
+
+	if creds.ServerURL != "" && explicitlyAnonymous(payload, &creds) {
+		return &creds, nil
+	}
+	if ok, err := creds.isValid(); !ok {
+		return nil, err
+	}
+	if len(creds.Secret) == 0 {
+		return nil, NewErrCredentialsMissingSecret()
+	}
+	return &creds, nil
+}
+
+// explicitlyAnonymous reports whether a store request holds anonymous
+// credentials, whose Username and Secret are both given and empty. Omitted
+// fields are still reported as missing.
+func explicitlyAnonymous(payload []byte, creds *ExtendedCredentials) bool {
+	if !creds.IsAnonymous() {
+		return false
+	}
+	var fields struct {
+		Username, Secret *string
+	}
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return false
+	}
+	return fields.Username != nil && fields.Secret != nil
+}
+
+// storeDecodeError turns an encoding/json error into a validation error.
+func storeDecodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case err == io.EOF:
+		return errors.New("invalid store request: no credentials provided")
+	case err == io.ErrUnexpectedEOF:
+		return errors.New("invalid store request: truncated JSON")
+	case errors.As(err, &syntaxErr):
+		return fmt.Errorf("invalid store request: malformed JSON at offset %d: %v", syntaxErr.Offset, err)
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return fmt.Errorf("invalid store request: expected a JSON object, got %s", typeErr.Value)
+		}
+		if strings.HasPrefix(typeErr.Field, "Metadata") {
+			return fmt.Errorf("invalid store request: field Metadata must be an object of strings, got %s", typeErr.Value)
+		}
+		return fmt.Errorf("invalid store request: field %s must be a string, got %s", typeErr.Field, typeErr.Value)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return fmt.Errorf("invalid store request: unknown field %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+	}
+	return fmt.Errorf("invalid store request: %v", err)
+}
+
+// parseServerURL validates the payload of a get or erase request, which is
+// a single server URL, optionally surrounded by whitespace.
+func parseServerURL(action string, payload []byte) (string, error) {
+	serverURL := strings.TrimSpace(string(payload))
+	if len(serverURL) == 0 {
+		return "", NewErrCredentialsMissingServerURL()
+	}
+	if strings.HasPrefix(serverURL, "{") {
+		return "", fmt.Errorf("invalid %s request: expected a server URL, not a JSON object", action)
+	}
+	if strings.ContainsAny(serverURL, "\r\n") {
+		return "", fmt.Errorf("invalid %s request: unexpected data after the server URL", action)
+	}
+	return serverURL, nil
+}
@@ -0,0 +1,171 @@
+package credentials
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStoreValidation(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		err  string
+	}{
+		{"empty", "", "invalid store request: no credentials provided"},
+		{"truncated", `{"ServerURL": "https://index.docker.io/v1/", "Username": "foo"`, "invalid store request: truncated JSON"},
+		{"malformed", `{"ServerURL" "https://index.docker.io/v1/"}`, "invalid store request: malformed JSON at offset 14: invalid character '\"' after object key"},
+		{"not an object", `["https://index.docker.io/v1/"]`, "invalid store request: expected a JSON object, got array"},
+		{"not a string", `{"ServerURL": "https://index.docker.io/v1/", "Username": 42, "Secret": "bar"}`, "invalid store request: field Username must be a string, got number"},
+		{"unknown field", `{"ServerURL": "https://index.docker.io/v1/", "Username": "foo", "Secret": "bar", "Password": "bar"}`, `invalid store request: unknown field "Password"`},
+		{"trailing data", `{"ServerURL": "https://index.docker.io/v1/", "Username": "foo", "Secret": "bar"} {}`, "invalid store request: unexpected data after the credentials"},
+		{"missing server URL", `{"Username": "foo", "Secret": "bar"}`, "no credentials server URL"},
+		{"missing username", `{"ServerURL": "https://index.docker.io/v1/", "Secret": "bar"}`, "no credentials username"},
+		{"missing secret", `{"ServerURL": "https://index.docker.io/v1/", "Username": "foo"}`, "no credentials secret"},
+		{"missing username and secret", `{"ServerURL": "https://index.docker.io/v1/"}`, "no credentials username"},
+		{"anonymous without server URL", `{"ServerURL": "", "Username": "", "Secret": ""}`, "no credentials server URL"},
+	}
+	for _, c := range cases {
+		h := newMemoryStore()
+		err := Store(h, strings.NewReader(c.in))
+		if err == nil || err.Error() != c.err {
+			t.Fatalf("%s: expected error %q, got %v", c.name, c.err, err)
+		}
+		if len(h.creds) != 0 {
+			t.Fatalf("%s: expected nothing to be stored, got %v", c.name, h.creds)
+		}
+	}
+}
+
+func TestStoreMissingSecret(t *testing.T) {
+	in := strings.NewReader(`{"ServerURL": "https://index.docker.io/v1/", "Username": "foo", "Secret": ""}`)
+	if err := Store(newMemoryStore(), in); !IsCredentialsMissingSecret(err) {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreAnonymous(t *testing.T) {
+	serverURL := "https://registry.example.com"
+	h := newMemoryStore()
+	in := strings.NewReader(`{"ServerURL": "https://registry.example.com", "Username": "", "Secret": ""}`)
+	if err := Store(h, in); err != nil {
+		t.Fatal(err)
+	}
+
+	w := new(bytes.Buffer)
+	if err := List(h, w); err != nil {
+		t.Fatal(err)
+	}
+	if w.String() != `{"https://registry.example.com":""}`+"\n" {
+		t.Fatalf("expected the anonymous entry to be listed, got %q", w.String())
+	}
+
+	w.Reset()
+	if err := Get(h, strings.NewReader(serverURL), w); err != nil {
+		t.Fatalf("expected the anonymous entry to be found, got %v", err)
+	}
+	if w.String() != `{"ServerURL":"https://registry.example.com","Username":"","Secret":""}`+"\n" {
+		t.Fatalf("expected empty credentials, got %q", w.String())
+	}
+
+	if err := Get(h, strings.NewReader("https://quay.io"), new(bytes.Buffer)); !IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected not found for a server URL without credentials, got %v", err)
+	}
+}
+
+func TestStoreMultilineJSON(t *testing.T) {
+	in := strings.NewReader("{\n  \"ServerURL\": \"https://index.docker.io/v1/\",\n  \"Username\": \"foo\",\n  \"Secret\": \"bar\"\n}\n")
+	h := newMemoryStore()
+	if err := Store(h, in); err != nil {
+		t.Fatal(err)
+	}
+	if c, ok := h.creds["https://index.docker.io/v1/"]; !ok || c.Secret != "bar" {
+		t.Fatalf("expected the credentials to be stored, got %v", h.creds)
+	}
+}
+
+func TestServerURLValidation(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		err  string
+	}{
+		{"empty", "", "no credentials server URL"},
+		{"blank", " \n", "no credentials server URL"},
+		{"JSON object", `{"ServerURL": "https://index.docker.io/v1/"}`, "invalid %s request: expected a server URL, not a JSON object"},
+		{"several lines", "https://index.docker.io/v1/\nhttps://quay.io", "invalid %s request: unexpected data after the server URL"},
+	}
+	for _, c := range cases {
+		h := newMemoryStore()
+		h.Add(&Credentials{ServerURL: "https://index.docker.io/v1/", Username: "foo", Secret: "bar"})
+
+		w := new(bytes.Buffer)
+		err := Get(h, strings.NewReader(c.in), w)
+		if expected := strings.Replace(c.err, "%s", "get", 1); err == nil || err.Error() != expected {
+			t.Fatalf("get %s: expected error %q, got %v", c.name, expected, err)
+		}
+		if w.Len() != 0 {
+			t.Fatalf("get %s: expected no output, got %q", c.name, w.String())
+		}
+
+		err = Erase(h, strings.NewReader(c.in))
+		if expected := strings.Replace(c.err, "%s", "erase", 1); err == nil || err.Error() != expected {
+			t.Fatalf("erase %s: expected error %q, got %v", c.name, expected, err)
+		}
+		if len(h.creds) != 1 {
+			t.Fatalf("erase %s: expected the credentials to be kept", c.name)
+		}
+	}
+}
+
+func TestServerURLSurroundingWhitespace(t *testing.T) {
+	serverURL := "https://index.docker.io/v1/"
+	h := newMemoryStore()
+	h.Add(&Credentials{ServerURL: serverURL, Username: "foo", Secret: "bar"})
+
+	w := new(bytes.Buffer)
+	if err := Get(h, strings.NewReader(" "+serverURL+"\r\n"), w); err != nil {
+		t.Fatal(err)
+	}
+	if err := Erase(h, strings.NewReader(serverURL+"\n")); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.creds) != 0 {
+		t.Fatalf("expected the credentials to be erased, got %v", h.creds)
+	}
+}
+
+// endlessReader fills every read, counting the bytes read from it.
+type endlessReader struct {
+	read int64
+}
+
+func (r *endlessReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'a'
+	}
+	r.read += int64(len(p))
+	return len(p), nil
+}
+
+func TestRequestTooLarge(t *testing.T) {
+	defer func(size int64) { MaxRequestSize = size }(MaxRequestSize)
+	MaxRequestSize = 64
+
+	for _, key := range []string{"store", "get", "erase"} {
+		in := &endlessReader{}
+		err := HandleCommand(newMemoryStore(), key, in, new(bytes.Buffer))
+		if err == nil || err.Error() != "request too large: exceeds 64 bytes" {
+			t.Fatalf("%s: expected a request too large error, got %v", key, err)
+		}
+		if in.read > 1024 {
+			t.Fatalf("%s: expected a bounded read, read %d bytes", key, in.read)
+		}
+	}
+
+	// Requests up to the limit are accepted.
+	serverURL := "https://index.docker.io/v1/" + strings.Repeat("a", 64-len("https://index.docker.io/v1/"))
+	if err := Erase(newMemoryStore(), strings.NewReader(serverURL)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,74 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ShutdownGrace is how long Serve waits for an interrupted operation to
+// return, for instance for the child processes it runs to exit, before
+// exiting anyway.
+var ShutdownGrace = 5 * time.Second
+
+var (
+	operationMutex sync.Mutex
+	operation      = context.Background()
+)
+
+// OperationContext returns the context of the operation being served. It is
+// canceled when Serve or ServeBackend receive SIGINT or SIGTERM, so helpers
+// should run their child processes with exec.CommandContext and send their
+// requests with it, which lets them stop when docker terminates the helper.
+func OperationContext() context.Context {
+	operationMutex.Lock()
+	defer operationMutex.Unlock()
+	return operation
+}
+
+// interruptible runs an operation, canceling its OperationContext when a
+// signal is received. It then waits up to ShutdownGrace for the operation
+// to return, and reports the interruption.
+func interruptible(signals <-chan os.Signal, run func() error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	operationMutex.Lock()
+	previous := operation
+	operation = ctx
+	operationMutex.Unlock()
+	defer func() {
+		operationMutex.Lock()
+		operation = previous
+		operationMutex.Unlock()
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- run()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case sig := <-signals:
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(ShutdownGrace):
+		}
+		return fmt.Errorf("interrupted by %v", sig)
+	}
+}
+
+// serveInterruptible runs an operation of Serve, interrupting it on SIGINT
+// and SIGTERM.
+func serveInterruptible(run func() error) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	return interruptible(signals, run)
+}
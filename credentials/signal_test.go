@@ -0,0 +1,57 @@
+package credentials
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestInterruptible(t *testing.T) {
+	expected := errors.New("done")
+	if err := interruptible(make(chan os.Signal), func() error { return expected }); err != expected {
+		t.Fatalf("expected the error of the operation, got %v", err)
+	}
+}
+
+func TestInterruptibleSignal(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep is not available")
+	}
+
+	signals := make(chan os.Signal, 1)
+	started := make(chan struct{})
+	childErr := make(chan error, 1)
+	go func() {
+		<-started
+		signals <- syscall.SIGTERM
+	}()
+
+	start := time.Now()
+	err := interruptible(signals, func() error {
+		cmd := exec.CommandContext(OperationContext(), "sleep", "10")
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		close(started)
+		err := cmd.Wait()
+		childErr <- err
+		return err
+	})
+	if err == nil || err.Error() != "interrupted by terminated" {
+		t.Fatalf("expected the operation to be interrupted, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > ShutdownGrace {
+		t.Fatalf("expected the child to be terminated, waited %v", elapsed)
+	}
+	select {
+	case err := <-childErr:
+		if err == nil {
+			t.Fatal("expected the child to be killed")
+		}
+	default:
+		t.Fatal("expected the operation to return before the shutdown")
+	}
+}
@@ -0,0 +1,114 @@
+package credentials
+
+import "fmt"
+
+// Transformer post-processes the credentials read from a store, for instance
+// to exchange a stored long-lived token for a short-lived one, and
+// pre-processes the credentials before they are stored.
+type Transformer interface {
+	// TransformGet is applied to the credentials returned by Get.
+	TransformGet(creds *Credentials) error
+	// TransformAdd is applied to the credentials passed to Add. It should
+	// undo TransformGet, if the transformation is reversible.
+	TransformAdd(creds *Credentials) error
+}
+
+// TransformFuncs adapts a pair of functions to a Transformer. A nil function
+// leaves the credentials unchanged.
+type TransformFuncs struct {
+	Get func(creds *Credentials) error
+	Add func(creds *Credentials) error
+}
+
+// TransformGet calls f.Get, if set.
+func (f TransformFuncs) TransformGet(creds *Credentials) error {
+	if f.Get == nil {
+		return nil
+	}
+	return f.Get(creds)
+}
+
+// TransformAdd calls f.Add, if set.
+func (f TransformFuncs) TransformAdd(creds *Credentials) error {
+	if f.Add == nil {
+		return nil
+	}
+	return f.Add(creds)
+}
+
+// transformedHelper applies a chain of transformers around a helper.
+type transformedHelper struct {
+	decorator
+	transformers []Transformer
+}
+
+// WithTransforms returns a helper applying the transformers, in order, to the
+// credentials returned by Get, and in reverse order to the credentials
+// passed to Add. Without transformers the credentials are left unchanged.
+// The protocol is not affected: Get still returns a username and a secret.
+func WithTransforms(helper Helper, transformers ...Transformer) Helper {
+	return transformedHelper{decorator: decorator{helper}, transformers: transformers}
+}
+
+func (h transformedHelper) Add(creds *Credentials) error {
+	if creds == nil {
+		return h.Helper.Add(creds)
+	}
+	return h.AddWithMeta(&ExtendedCredentials{Credentials: *creds})
+}
+
+func (h transformedHelper) AddWithMeta(creds *ExtendedCredentials) error {
+	if creds == nil {
+		return AddWithMeta(h.Helper, creds)
+	}
+	transformed := *creds
+	for i := len(h.transformers) - 1; i >= 0; i-- {
+		if err := h.transformers[i].TransformAdd(&transformed.Credentials); err != nil {
+			return err
+		}
+	}
+	return AddWithMeta(h.Helper, &transformed)
+}
+
+func (h transformedHelper) Get(serverURL string) (string, string, error) {
+	return getCredentials(h.GetWithMeta(serverURL))
+}
+
+func (h transformedHelper) GetWithMeta(serverURL string) (*ExtendedCredentials, error) {
+	creds, err := GetWithMeta(h.Helper, serverURL)
+	if err != nil {
+		return nil, err
+	}
+	creds.ServerURL = serverURL
+	for _, t := range h.transformers {
+		if err := t.TransformGet(&creds.Credentials); err != nil {
+			return nil, err
+		}
+	}
+	return creds, nil
+}
+
+// MintFunc exchanges the credentials stored for a registry, such as a
+// long-lived token, for the short-lived credentials handed to the client
+// instead. It returns the username and the secret to use.
+type MintFunc func(stored Credentials) (username, secret string, err error)
+
+// Mint returns a Transformer which mints the credentials returned by Get
+// from the stored ones, so that clients only ever see ephemeral tokens while
+// long-lived secrets stay in the store. Credentials are stored unchanged.
+// A nil MintFunc returns the stored credentials.
+func Mint(mint MintFunc) Transformer {
+	return TransformFuncs{
+		Get: func(creds *Credentials) error {
+			if mint == nil {
+				return nil
+			}
+			username, secret, err := mint(*creds)
+			if err != nil {
+				return fmt.Errorf("minting credentials for %s: %v", creds.ServerURL, err)
+			}
+			creds.Username, creds.Secret = username, secret
+			return nil
+		},
+	}
+}
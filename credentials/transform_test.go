@@ -0,0 +1,122 @@
+package credentials
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWithTransforms(t *testing.T) {
+	serverURL := "https://index.docker.io/v1/"
+	store := newMemoryStore()
+
+	var order []string
+	h := WithTransforms(store,
+		TransformFuncs{
+			Get: func(c *Credentials) error {
+				order = append(order, "upper")
+				c.Secret = strings.ToUpper(c.Secret)
+				return nil
+			},
+		},
+		TransformFuncs{
+			Get: func(c *Credentials) error {
+				order = append(order, "suffix")
+				c.Secret += "-suffix"
+				return nil
+			},
+			Add: func(c *Credentials) error {
+				c.Secret = strings.TrimSuffix(c.Secret, "-suffix")
+				return nil
+			},
+		},
+	)
+
+	creds := &Credentials{ServerURL: serverURL, Username: "foo", Secret: "bar-suffix"}
+	if err := h.Add(creds); err != nil {
+		t.Fatal(err)
+	}
+	if store.creds[serverURL].Secret != "bar" {
+		t.Fatalf("expected the add transform to be applied, got %s", store.creds[serverURL].Secret)
+	}
+	if creds.Secret != "bar-suffix" {
+		t.Fatalf("expected the caller's credentials to be left untouched, got %s", creds.Secret)
+	}
+
+	w := new(bytes.Buffer)
+	if err := Get(h, strings.NewReader(serverURL), w); err != nil {
+		t.Fatal(err)
+	}
+	var c Credentials
+	if err := json.NewDecoder(w).Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Username != "foo" || c.Secret != "BAR-suffix" {
+		t.Fatalf("expected the get transforms to be applied in order, got %s:%s", c.Username, c.Secret)
+	}
+	if strings.Join(order, ",") != "upper,suffix" {
+		t.Fatalf("unexpected transform order %v", order)
+	}
+}
+
+func TestWithTransformsError(t *testing.T) {
+	store := newMemoryStore()
+	store.Add(&Credentials{ServerURL: "https://index.docker.io/v1/", Username: "foo", Secret: "bar"})
+
+	expected := errors.New("exchange failed")
+	h := WithTransforms(store, TransformFuncs{Get: func(c *Credentials) error { return expected }})
+	if _, _, err := h.Get("https://index.docker.io/v1/"); err != expected {
+		t.Fatalf("expected the transform error, got %v", err)
+	}
+
+	// Without transformers, credentials are returned as stored.
+	username, secret, err := WithTransforms(store).Get("https://index.docker.io/v1/")
+	if err != nil || username != "foo" || secret != "bar" {
+		t.Fatalf("unexpected credentials %s:%s, %v", username, secret, err)
+	}
+}
+
+func TestMint(t *testing.T) {
+	serverURL := "https://registry.example.com"
+	store := newMemoryStore()
+
+	var minted []Credentials
+	h := WithTransforms(store, Mint(func(stored Credentials) (string, string, error) {
+		minted = append(minted, stored)
+		if stored.Secret != "long-lived" {
+			return "", "", errors.New("invalid refresh token")
+		}
+		return "<token>", "short-lived", nil
+	}))
+
+	if err := h.Add(&Credentials{ServerURL: serverURL, Username: "foo", Secret: "long-lived"}); err != nil {
+		t.Fatal(err)
+	}
+	if store.creds[serverURL].Secret != "long-lived" {
+		t.Fatalf("expected the long-lived secret to be stored, got %s", store.creds[serverURL].Secret)
+	}
+
+	username, secret, err := h.Get(serverURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if username != "<token>" || secret != "short-lived" {
+		t.Fatalf("expected the minted credentials, got %s:%s", username, secret)
+	}
+	if len(minted) != 1 || minted[0].ServerURL != serverURL || minted[0].Username != "foo" {
+		t.Fatalf("expected the stored credentials to be minted once, got %v", minted)
+	}
+
+	store.Add(&Credentials{ServerURL: serverURL, Username: "foo", Secret: "revoked"})
+	if _, _, err := h.Get(serverURL); err == nil || err.Error() != "minting credentials for "+serverURL+": invalid refresh token" {
+		t.Fatalf("expected the minting error, got %v", err)
+	}
+
+	// The default hook returns the stored credentials.
+	username, secret, err = WithTransforms(store, Mint(nil)).Get(serverURL)
+	if err != nil || username != "foo" || secret != "revoked" {
+		t.Fatalf("unexpected credentials %s:%s, %v", username, secret, err)
+	}
+}
@@ -0,0 +1,71 @@
+package credentials
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DefaultUsernamesEnv is the environment variable holding the DefaultUsernames
+// applied by Serve, as a comma separated list of "registry=username" pairs.
+const DefaultUsernamesEnv = "DOCKER_CREDS_DEFAULT_USERNAMES"
+
+// DefaultUsernames maps a registry host to the username of its well-known
+// shared account. As a Transformer, it fills in the username of credentials
+// stored without one. Stored usernames always take precedence, and anonymous
+// credentials are left as is. Hosts include the port, if any.
+type DefaultUsernames map[string]string
+
+// ParseDefaultUsernames reads a comma separated list of "registry=username"
+// pairs. Registries are given by host or by server URL.
+func ParseDefaultUsernames(value string) (DefaultUsernames, error) {
+	usernames := DefaultUsernames{}
+	for _, pair := range strings.Split(value, ",") {
+		i := strings.Index(pair, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid default username %q, expected registry=username", pair)
+		}
+		host, err := aliasHost(strings.TrimSpace(pair[:i]))
+		username := strings.TrimSpace(pair[i+1:])
+		if err != nil || username == "" {
+			return nil, fmt.Errorf("invalid default username %q, expected registry=username", pair)
+		}
+		usernames[host] = username
+	}
+	return usernames, nil
+}
+
+func (d DefaultUsernames) fill(creds *Credentials) {
+	if creds.Username != "" || creds.IsAnonymous() {
+		return
+	}
+	if host, err := aliasHost(creds.ServerURL); err == nil {
+		creds.Username = d[host]
+	}
+}
+
+// TransformGet fills in the default username of credentials without one.
+func (d DefaultUsernames) TransformGet(creds *Credentials) error {
+	d.fill(creds)
+	return nil
+}
+
+// TransformAdd fills in the default username of credentials without one.
+func (d DefaultUsernames) TransformAdd(creds *Credentials) error {
+	d.fill(creds)
+	return nil
+}
+
+// defaultUsernamesFromEnv returns the default usernames configured with
+// DefaultUsernamesEnv, or nil.
+func defaultUsernamesFromEnv() (DefaultUsernames, error) {
+	value := os.Getenv(DefaultUsernamesEnv)
+	if value == "" {
+		return nil, nil
+	}
+	usernames, err := ParseDefaultUsernames(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", DefaultUsernamesEnv, err)
+	}
+	return usernames, nil
+}
@@ -0,0 +1,74 @@
+package credentials
+
+import (
+	"os"
+	"testing"
+)
+
+func TestDefaultUsernames(t *testing.T) {
+	usernames, err := ParseDefaultUsernames("ghcr.io=ci-bot, https://registry.example.com:5000 = shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := newMemoryStore()
+	store.creds["ghcr.io"] = &Credentials{ServerURL: "ghcr.io", Secret: "token"}
+	store.creds["registry.example.com:5000"] = &Credentials{ServerURL: "registry.example.com:5000", Username: "own", Secret: "secret"}
+	store.creds["quay.io"] = &Credentials{ServerURL: "quay.io", Secret: "token"}
+	h := WithTransforms(store, usernames)
+
+	tests := []struct {
+		serverURL string
+		username  string
+	}{
+		{serverURL: "ghcr.io", username: "ci-bot"},
+		{serverURL: "registry.example.com:5000", username: "own"},
+		{serverURL: "quay.io", username: ""},
+	}
+	for _, te := range tests {
+		username, _, err := h.Get(te.serverURL)
+		if err != nil {
+			t.Fatalf("%s: %v", te.serverURL, err)
+		}
+		if username != te.username {
+			t.Fatalf("%s: expected username %q, got %q", te.serverURL, te.username, username)
+		}
+	}
+
+	if err := h.Add(&Credentials{ServerURL: "ghcr.io", Secret: "new"}); err != nil {
+		t.Fatal(err)
+	}
+	if c := store.creds["ghcr.io"]; c.Username != "ci-bot" {
+		t.Fatalf("expected the default username to be stored, got %+v", c)
+	}
+
+	if err := h.Add(&Credentials{ServerURL: "ghcr.io"}); err != nil {
+		t.Fatal(err)
+	}
+	if username, _, err := h.Get("ghcr.io"); err != nil || username != "" {
+		t.Fatalf("expected anonymous credentials to be left as is, got %q, %v", username, err)
+	}
+
+	if _, err := ParseDefaultUsernames("ghcr.io"); err == nil {
+		t.Fatal("expected a pair without username to be rejected")
+	}
+}
+
+func TestDefaultUsernamesFromEnv(t *testing.T) {
+	defer os.Setenv(DefaultUsernamesEnv, os.Getenv(DefaultUsernamesEnv))
+
+	os.Setenv(DefaultUsernamesEnv, "ghcr.io=ci-bot")
+	store := newMemoryStore()
+	store.creds["ghcr.io"] = &Credentials{ServerURL: "ghcr.io", Secret: "token"}
+	h, err := configure(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if username, _, err := h.Get("ghcr.io"); err != nil || username != "ci-bot" {
+		t.Fatalf("expected the default username, got %s, %v", username, err)
+	}
+
+	os.Setenv(DefaultUsernamesEnv, "ghcr.io")
+	if _, err := configure(store); err == nil {
+		t.Fatal("expected an invalid value to be rejected")
+	}
+}
@@ -0,0 +1,247 @@
+package credentials
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker-credential-helpers/registryurl"
+)
+
+// Statuses of the credentials checked by Verify.
+const (
+	StatusValid       = "valid"
+	StatusInvalid     = "invalid"
+	StatusUnreachable = "unreachable"
+)
+
+// VerifyResult reports whether the registry of a server URL accepts the
+// credentials stored for it.
+type VerifyResult struct {
+	ServerURL string
+	Username  string
+	Status    string
+	Error     string `json:",omitempty"`
+}
+
+// Prober checks credentials against their registry.
+type Prober interface {
+	// Probe reports whether the registry of a server URL accepts the
+	// credentials. It returns an error when the registry cannot be reached
+	// or gives an unexpected answer. Errors must not include the secret.
+	Probe(serverURL, username, secret string) (bool, error)
+}
+
+// VerifyInterval is the time Verify waits between two probes, so that
+// verifying many credentials does not flood the registries.
+var VerifyInterval = 500 * time.Millisecond
+
+// Verify checks the credentials of every server URL listed by a helper with
+// a prober, waiting interval between probes. The results are sorted by
+// server URL. Credentials with the IdentityTokenUsername are probed as
+// identity tokens.
+func Verify(helper Helper, prober Prober, interval time.Duration) ([]VerifyResult, error) {
+	accts, err := helper.List()
+	if err != nil {
+		return nil, err
+	}
+	serverURLs := make([]string, 0, len(accts))
+	for serverURL := range accts {
+		serverURLs = append(serverURLs, serverURL)
+	}
+	sort.Strings(serverURLs)
+
+	results := make([]VerifyResult, 0, len(serverURLs))
+	for i, serverURL := range serverURLs {
+		username, secret, err := helper.Get(serverURL)
+		if IsErrCredentialsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if i > 0 && interval > 0 {
+			time.Sleep(interval)
+		}
+		result := VerifyResult{ServerURL: serverURL, Username: username, Status: StatusValid}
+		valid, err := prober.Probe(serverURL, username, secret)
+		switch {
+		case err != nil:
+			result.Status = StatusUnreachable
+			result.Error = err.Error()
+		case !valid:
+			result.Status = StatusInvalid
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// PrintVerify verifies the credentials of a helper against their registries
+// with an HTTPProber, and writes the JSON serialization of the results.
+func PrintVerify(helper Helper, writer io.Writer) error {
+	results, err := Verify(helper, HTTPProber{}, VerifyInterval)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(writer).Encode(results)
+}
+
+// HTTPProber probes credentials against the /v2/ endpoint of registries,
+// following the token authentication of registries which require it. A nil
+// Client falls back to a client with a 30 seconds timeout.
+type HTTPProber struct {
+	Client *http.Client
+}
+
+func (p HTTPProber) client() *http.Client {
+	if p.Client != nil {
+		return p.Client
+	}
+	return &http.Client{Timeout: 30 * time.Second}
+}
+
+// Probe sends the credentials to the /v2/ endpoint of the registry, or to
+// the token endpoint it points to.
+func (p HTTPProber) Probe(serverURL, username, secret string) (bool, error) {
+	u, err := registryurl.Parse(serverURL)
+	if err != nil {
+		return false, err
+	}
+	if u.Scheme == "" {
+		u.Scheme = "https"
+	}
+	if u.Host == "index.docker.io" {
+		u.Host = "registry-1.docker.io"
+	}
+	endpoint := u.Scheme + "://" + u.Host + "/v2/"
+
+	req, err := http.NewRequestWithContext(OperationContext(), http.MethodGet, endpoint, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		// The registry does not require authentication.
+		return true, nil
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return false, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, endpoint)
+	}
+
+	scheme, params := parseChallenge(resp.Header.Get("WWW-Authenticate"))
+	switch scheme {
+	case "basic":
+		req, err = http.NewRequestWithContext(OperationContext(), http.MethodGet, endpoint, nil)
+		if err != nil {
+			return false, err
+		}
+		req.SetBasicAuth(username, secret)
+	case "bearer":
+		if req, err = tokenRequest(params, u.Scheme, username, secret); err != nil {
+			return false, err
+		}
+	default:
+		return false, fmt.Errorf("unsupported authentication challenge from %s", endpoint)
+	}
+
+	resp, err = p.client().Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusBadRequest:
+		return false, nil
+	}
+	return false, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, req.URL.Host)
+}
+
+// tokenRequest returns the request of a token to the realm of a bearer
+// challenge, authenticated with the credentials. The challenge is not
+// authenticated, so the credentials are only sent over https, or over http
+// to registries which are themselves reached over http, given by scheme.
+func tokenRequest(params map[string]string, scheme, username, secret string) (*http.Request, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Host == "" {
+		return nil, fmt.Errorf("invalid token realm %q", params["realm"])
+	}
+	if realm.Scheme != "https" && (realm.Scheme != "http" || scheme != "http") {
+		return nil, fmt.Errorf("refusing to send credentials to the token realm %s over %s", realm.Host, realm.Scheme)
+	}
+
+	if username == IdentityTokenUsername {
+		form := url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {secret},
+			"service":       {params["service"]},
+			"client_id":     {"docker-credential-helpers"},
+		}
+		req, err := http.NewRequestWithContext(OperationContext(), http.MethodPost, realm.String(), strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	}
+
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	realm.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(OperationContext(), http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(username, secret)
+	return req, nil
+}
+
+// parseChallenge returns the lower case scheme and the parameters of a
+// WWW-Authenticate header such as `Bearer realm="https://auth.docker.io/token",service="registry.docker.io"`.
+func parseChallenge(header string) (string, map[string]string) {
+	header = strings.TrimSpace(header)
+	scheme := header
+	rest := ""
+	if i := strings.IndexByte(header, ' '); i >= 0 {
+		scheme, rest = header[:i], header[i+1:]
+	}
+	params := map[string]string{}
+	for rest != "" {
+		i := strings.IndexByte(rest, '=')
+		if i < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:i]))
+		rest = strings.TrimSpace(rest[i+1:])
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if j := strings.IndexByte(rest, ','); j >= 0 {
+			value, rest = rest[:j], rest[j:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = value
+		rest = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+	}
+	return strings.ToLower(scheme), params
+}
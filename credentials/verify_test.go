@@ -0,0 +1,131 @@
+package credentials
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeProber accepts the secret "valid" and cannot reach unreachable.example.com.
+type fakeProber struct {
+	probes []time.Time
+}
+
+func (p *fakeProber) Probe(serverURL, username, secret string) (bool, error) {
+	p.probes = append(p.probes, time.Now())
+	if serverURL == "https://unreachable.example.com" {
+		return false, errors.New("dial tcp: connection refused")
+	}
+	return secret == "valid", nil
+}
+
+func TestVerify(t *testing.T) {
+	h := newMemoryStore()
+	h.Add(&Credentials{ServerURL: "https://valid.example.com", Username: "foo", Secret: "valid"})
+	h.Add(&Credentials{ServerURL: "https://revoked.example.com", Username: "foo", Secret: "revoked"})
+	h.Add(&Credentials{ServerURL: "https://unreachable.example.com", Username: "foo", Secret: "valid"})
+
+	prober := &fakeProber{}
+	results, err := Verify(h, prober, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []VerifyResult{
+		{ServerURL: "https://revoked.example.com", Username: "foo", Status: StatusInvalid},
+		{ServerURL: "https://unreachable.example.com", Username: "foo", Status: StatusUnreachable, Error: "dial tcp: connection refused"},
+		{ServerURL: "https://valid.example.com", Username: "foo", Status: StatusValid},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, results)
+	}
+	for i := 1; i < len(prober.probes); i++ {
+		if gap := prober.probes[i].Sub(prober.probes[i-1]); gap < 10*time.Millisecond {
+			t.Fatalf("expected probes to be rate limited, got a gap of %v", gap)
+		}
+	}
+}
+
+func TestHTTPProber(t *testing.T) {
+	var token *httptest.Server
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+token.URL+`/token",service="registry.example.com"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer registry.Close()
+	token = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("service") != "registry.example.com" && r.PostFormValue("service") != "registry.example.com" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		username, password, _ := r.BasicAuth()
+		if username == "foo" && password == "bar" || r.PostFormValue("refresh_token") == "identity" {
+			w.Write([]byte(`{"token": "t"}`))
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer token.Close()
+
+	cases := []struct {
+		username string
+		secret   string
+		valid    bool
+	}{
+		{"foo", "bar", true},
+		{"foo", "wrong", false},
+		{IdentityTokenUsername, "identity", true},
+		{IdentityTokenUsername, "revoked", false},
+	}
+	for _, c := range cases {
+		valid, err := HTTPProber{}.Probe(registry.URL, c.username, c.secret)
+		if err != nil {
+			t.Fatalf("%s:%s: %v", c.username, c.secret, err)
+		}
+		if valid != c.valid {
+			t.Fatalf("%s:%s: expected valid %v, got %v", c.username, c.secret, c.valid, valid)
+		}
+	}
+
+	registry.Close()
+	if _, err := (HTTPProber{}).Probe(registry.URL, "foo", "bar"); err == nil {
+		t.Fatal("expected an unreachable registry to fail the probe")
+	}
+}
+
+func TestHTTPProberRealmDowngrade(t *testing.T) {
+	sent := false
+	token := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = true
+		w.Write([]byte(`{"token": "t"}`))
+	}))
+	defer token.Close()
+	for _, realm := range []string{token.URL + "/token", "ftp://auth.example.com/token"} {
+		registry := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+realm+`",service="registry.example.com"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		_, err := HTTPProber{Client: registry.Client()}.Probe(registry.URL, "foo", "bar")
+		registry.Close()
+		if err == nil || !strings.Contains(err.Error(), "refusing to send credentials") {
+			t.Fatalf("%s: expected the realm of an https registry to be refused, got %v", realm, err)
+		}
+	}
+	if sent {
+		t.Fatal("expected no request to reach the token realm")
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope=repository:library/alpine:pull`)
+	expected := map[string]string{"realm": "https://auth.docker.io/token", "service": "registry.docker.io", "scope": "repository:library/alpine:pull"}
+	if scheme != "bearer" || !reflect.DeepEqual(params, expected) {
+		t.Fatalf("unexpected challenge %s %v", scheme, params)
+	}
+	if scheme, _ := parseChallenge(`Basic realm="Registry"`); scheme != "basic" {
+		t.Fatalf("expected a basic challenge, got %s", scheme)
+	}
+}
@@ -0,0 +1,113 @@
+package credentials
+
+import (
+	"os"
+	"strings"
+
+	"github.com/docker/docker-credential-helpers/registryurl"
+)
+
+// WildcardsEnv is the environment variable enabling wildcard entries in
+// Serve when set to "1".
+const WildcardsEnv = "DOCKER_CREDS_WILDCARDS"
+
+// wildcardHelper falls back to wildcard entries on lookup misses.
+type wildcardHelper struct {
+	decorator
+}
+
+// WithWildcards returns a helper that lets one credential serve every
+// subdomain of a domain. Credentials stored for a server URL such as
+// "https://*.corp.example" are returned by Get for any host under
+// corp.example which has no credentials of its own.
+//
+// Exact entries take precedence over wildcard entries, and the wildcard of
+// the closest parent domain wins: registry.eu.corp.example uses
+// *.eu.corp.example before *.corp.example. For hosts with a port, a wildcard
+// with the same port, such as *.corp.example:5000, is preferred over one
+// without. Wildcards must cover at least two labels, so *.com is never used.
+func WithWildcards(helper Helper) Helper {
+	return wildcardHelper{decorator: decorator{helper}}
+}
+
+// wildcardURL returns the canonical server URL of a wildcard entry.
+func wildcardURL(hostport string) string {
+	return "https://" + hostport
+}
+
+// Add stores wildcard entries under their canonical server URL, so that Get
+// can find them whatever form of URL was used to store them.
+func (h wildcardHelper) Add(creds *Credentials) error {
+	if creds == nil {
+		return h.Helper.Add(creds)
+	}
+	return h.AddWithMeta(&ExtendedCredentials{Credentials: *creds})
+}
+
+func (h wildcardHelper) AddWithMeta(creds *ExtendedCredentials) error {
+	if creds != nil {
+		if u, err := registryurl.Parse(creds.ServerURL); err == nil && strings.HasPrefix(u.Host, "*.") {
+			canonical := *creds
+			canonical.ServerURL = wildcardURL(u.Host)
+			return AddWithMeta(h.Helper, &canonical)
+		}
+	}
+	return AddWithMeta(h.Helper, creds)
+}
+
+func (h wildcardHelper) Get(serverURL string) (string, string, error) {
+	return getCredentials(h.GetWithMeta(serverURL))
+}
+
+func (h wildcardHelper) GetWithMeta(serverURL string) (*ExtendedCredentials, error) {
+	creds, err := GetWithMeta(h.Helper, serverURL)
+	if !IsErrCredentialsNotFound(err) {
+		return creds, err
+	}
+
+	for _, c := range wildcardCandidates(serverURL) {
+		creds, wildcardErr := GetWithMeta(h.Helper, c)
+		if !IsErrCredentialsNotFound(wildcardErr) {
+			return creds, wildcardErr
+		}
+	}
+	return nil, err
+}
+
+func (h wildcardHelper) ResolveBackend(serverURL string) (string, bool, error) {
+	name, found, err := Resolve(h.Helper, serverURL)
+	if err != nil || found {
+		return name, found, err
+	}
+	for _, c := range wildcardCandidates(serverURL) {
+		if name, found, err := Resolve(h.Helper, c); err != nil || found {
+			return name, found, err
+		}
+	}
+	return "", false, nil
+}
+
+// wildcardCandidates returns the server URLs of the wildcard entries which
+// may hold the credentials of a server URL, by order of precedence.
+func wildcardCandidates(serverURL string) []string {
+	u, err := registryurl.Parse(serverURL)
+	if err != nil {
+		return nil
+	}
+	hostname, port := registryurl.GetHostname(u), registryurl.GetPort(u)
+
+	var candidates []string
+	labels := strings.Split(hostname, ".")
+	for i := 1; len(labels)-i >= 2; i++ {
+		domain := "*." + strings.Join(labels[i:], ".")
+		if port != "" {
+			candidates = append(candidates, wildcardURL(domain+":"+port))
+		}
+		candidates = append(candidates, wildcardURL(domain))
+	}
+	return candidates
+}
+
+func wildcardsFromEnv() bool {
+	return os.Getenv(WildcardsEnv) == "1"
+}
@@ -0,0 +1,60 @@
+package credentials
+
+import (
+	"testing"
+)
+
+func TestWithWildcards(t *testing.T) {
+	store := newMemoryStore()
+	h := WithWildcards(store)
+
+	for _, c := range []*Credentials{
+		{ServerURL: "*.corp.example", Username: "corp", Secret: "corpsecret"},
+		{ServerURL: "https://*.eu.corp.example/v2/", Username: "eu", Secret: "eusecret"},
+		{ServerURL: "*.corp.example:5000", Username: "corp5000", Secret: "corp5000secret"},
+		{ServerURL: "https://exact.corp.example", Username: "exact", Secret: "exactsecret"},
+	} {
+		if err := h.Add(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := store.creds["https://*.corp.example"]; !ok {
+		t.Fatalf("expected the wildcard entry to be stored under its canonical URL, got %v", store.creds)
+	}
+
+	tests := []struct {
+		serverURL string
+		username  string
+	}{
+		{serverURL: "https://registry.corp.example", username: "corp"},
+		{serverURL: "registry.team.corp.example", username: "corp"},
+		{serverURL: "https://registry.eu.corp.example/v2/", username: "eu"},
+		{serverURL: "https://registry.corp.example:5000", username: "corp5000"},
+		{serverURL: "https://registry.corp.example:6000", username: "corp"},
+		{serverURL: "https://exact.corp.example", username: "exact"},
+	}
+	for _, te := range tests {
+		username, _, err := h.Get(te.serverURL)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %v", te.serverURL, err)
+		}
+		if username != te.username {
+			t.Errorf("expected %s for %s, got %s", te.username, te.serverURL, username)
+		}
+	}
+
+	for _, serverURL := range []string{"https://corp.example", "https://registry.other.example"} {
+		if _, _, err := h.Get(serverURL); !IsErrCredentialsNotFound(err) {
+			t.Errorf("expected not found error for %s, got %v", serverURL, err)
+		}
+	}
+}
+
+func TestWithWildcardsTopLevelDomain(t *testing.T) {
+	store := newMemoryStore()
+	store.Add(&Credentials{ServerURL: "https://*.example", Username: "tld", Secret: "tldsecret"})
+
+	if _, _, err := WithWildcards(store).Get("https://registry.example"); !IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected single label wildcards to be ignored, got %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+// A read-only credential helper serving the credentials of a Docker config
+// file, such as a config.json or a Kubernetes .dockerconfigjson secret
+// mounted read-only into a container. The file is read from the path given
+// by DOCKERCONFIGJSON_PATH, and its "auths" object holds the credentials of
+// each registry:
+//
+//	{"auths": {"registry.example.com": {"auth": "Zm9vOmJhcg=="}}}
+//
+// where "auth" is the base64 encoding of "username:password". Entries with
+// an "identitytoken" are returned with the <token> username, which docker
+// reads as an identity token.
+package dockerconfig
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/docker/docker-credential-helpers/registryurl"
+)
+
+// EnvPath is the environment variable giving the path of the config file.
+const EnvPath = "DOCKERCONFIGJSON_PATH"
+
+// errReadOnly is returned when storing or erasing credentials, which the
+// config file does not support.
+var errReadOnly = fmt.Errorf("dockerconfig: credentials are read from a docker config file: %w", credentials.ErrReadOnly)
+
+// ConfigFile handles secrets using a Docker config file as a read-only store.
+// An empty Path falls back to EnvPath.
+type ConfigFile struct {
+	Path string
+}
+
+// authEntry is an entry of the "auths" object of a config file.
+type authEntry struct {
+	Auth          string `json:"auth"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identitytoken"`
+}
+
+type configFile struct {
+	Auths map[string]authEntry `json:"auths"`
+}
+
+func (c ConfigFile) path() string {
+	if c.Path != "" {
+		return c.Path
+	}
+	return os.Getenv(EnvPath)
+}
+
+// auths reads the "auths" object of the config file.
+func (c ConfigFile) auths() (map[string]authEntry, error) {
+	path := c.path()
+	if path == "" {
+		return nil, fmt.Errorf("dockerconfig: %s is not set", EnvPath)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("dockerconfig: %v", err)
+	}
+	var f configFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("dockerconfig: invalid config file %s: %v", path, err)
+	}
+	return f.Auths, nil
+}
+
+// credentials returns the username and the secret of an entry.
+func (e authEntry) credentials(key string) (string, string, error) {
+	if e.IdentityToken != "" {
+		return credentials.IdentityTokenUsername, e.IdentityToken, nil
+	}
+	if e.Auth == "" {
+		return e.Username, e.Password, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(e.Auth)
+	if err != nil {
+		return "", "", fmt.Errorf("dockerconfig: invalid auth for %s: %v", key, err)
+	}
+	i := strings.IndexByte(string(decoded), ':')
+	if i < 0 {
+		return "", "", fmt.Errorf("dockerconfig: invalid auth for %s: expected username:password", key)
+	}
+	return string(decoded[:i]), string(decoded[i+1:]), nil
+}
+
+// lookup returns the key of the entry holding the credentials of a server
+// URL, matching it exactly or by host. Keys holding the same host are tried
+// in order, so that lookups do not depend on map order.
+func lookup(auths map[string]authEntry, serverURL string) (string, bool, error) {
+	if _, ok := auths[serverURL]; ok {
+		return serverURL, true, nil
+	}
+	u, err := registryurl.Parse(serverURL)
+	if err != nil {
+		return "", false, err
+	}
+	keys := make([]string, 0, len(auths))
+	for key := range auths {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if k, err := registryurl.Parse(key); err == nil && k.Host == u.Host {
+			return key, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// Add is not supported and returns an error wrapping
+// credentials.ErrReadOnly.
+func (c ConfigFile) Add(creds *credentials.Credentials) error {
+	return errReadOnly
+}
+
+// Delete is not supported and returns an error wrapping
+// credentials.ErrReadOnly.
+func (c ConfigFile) Delete(serverURL string) error {
+	return errReadOnly
+}
+
+// Get returns the username and secret to use for a given registry server URL.
+func (c ConfigFile) Get(serverURL string) (string, string, error) {
+	if serverURL == "" {
+		return "", "", errors.New("missing server url")
+	}
+
+	auths, err := c.auths()
+	if err != nil {
+		return "", "", err
+	}
+	key, ok, err := lookup(auths, serverURL)
+	if err != nil {
+		return "", "", err
+	}
+	if !ok {
+		return "", "", credentials.NewErrCredentialsNotFound()
+	}
+	return auths[key].credentials(key)
+}
+
+// List returns the registries of the config file and the corresponding
+// usernames.
+func (c ConfigFile) List() (map[string]string, error) {
+	auths, err := c.auths()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := map[string]string{}
+	for key, entry := range auths {
+		username, _, err := entry.credentials(key)
+		if err != nil {
+			return nil, err
+		}
+		resp[key] = username
+	}
+	return resp, nil
+}
@@ -0,0 +1,104 @@
+package dockerconfig
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+)
+
+// testConfig holds the credentials of Docker Hub, foo:bar, the identity token
+// of a private registry and the plain username and password of a third one.
+const testConfig = `{
+	"auths": {
+		"https://index.docker.io/v1/": {"auth": "Zm9vOmJhcg=="},
+		"registry.example.com": {"auth": "", "identitytoken": "eyJhbGciOi.token"},
+		"quay.io": {"username": "robot", "password": "s3cr3t:with:colons"}
+	},
+	"credsStore": "dockerconfig"
+}`
+
+func writeConfig(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "dockerconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestConfigFileHelper(t *testing.T) {
+	path, cleanup := writeConfig(t, testConfig)
+	defer cleanup()
+
+	helper := ConfigFile{Path: path}
+	tests := []struct {
+		serverURL string
+		username  string
+		secret    string
+	}{
+		{serverURL: "https://index.docker.io/v1/", username: "foo", secret: "bar"},
+		{serverURL: "https://registry.example.com/v2/", username: credentials.IdentityTokenUsername, secret: "eyJhbGciOi.token"},
+		{serverURL: "quay.io", username: "robot", secret: "s3cr3t:with:colons"},
+	}
+	for _, te := range tests {
+		username, secret, err := helper.Get(te.serverURL)
+		if err != nil {
+			t.Fatalf("%s: %v", te.serverURL, err)
+		}
+		if username != te.username || secret != te.secret {
+			t.Fatalf("%s: expected %s:%s, got %s:%s", te.serverURL, te.username, te.secret, username, secret)
+		}
+	}
+
+	if _, _, err := helper.Get("https://gcr.io"); !credentials.IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+
+	list, err := helper.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || list["https://index.docker.io/v1/"] != "foo" || list["registry.example.com"] != credentials.IdentityTokenUsername {
+		t.Fatalf("unexpected list result: %v", list)
+	}
+
+	if err := helper.Add(&credentials.Credentials{ServerURL: "https://gcr.io", Username: "foo", Secret: "bar"}); !errors.Is(err, credentials.ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+	if err := helper.Delete("https://index.docker.io/v1/"); !errors.Is(err, credentials.ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+}
+
+func TestConfigFileHelperPathFromEnv(t *testing.T) {
+	path, cleanup := writeConfig(t, testConfig)
+	defer cleanup()
+	defer os.Setenv(EnvPath, os.Getenv(EnvPath))
+
+	os.Setenv(EnvPath, path)
+	if _, _, err := (ConfigFile{}).Get("https://index.docker.io/v1/"); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Unsetenv(EnvPath)
+	if _, err := (ConfigFile{}).List(); err == nil || err.Error() != "dockerconfig: DOCKERCONFIGJSON_PATH is not set" {
+		t.Fatalf("expected a missing configuration error, got %v", err)
+	}
+}
+
+func TestConfigFileHelperInvalidAuth(t *testing.T) {
+	path, cleanup := writeConfig(t, `{"auths": {"registry.example.com": {"auth": "bm9jb2xvbg=="}}}`)
+	defer cleanup()
+
+	_, _, err := ConfigFile{Path: path}.Get("registry.example.com")
+	if err == nil || err.Error() != "dockerconfig: invalid auth for registry.example.com: expected username:password" {
+		t.Fatalf("expected an invalid auth error, got %v", err)
+	}
+}
@@ -0,0 +1,228 @@
+package ecr
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+)
+
+// DefaultTimeout is the timeout of requests made by a client without an
+// HTTPClient of its own.
+const DefaultTimeout = 30 * time.Second
+
+var defaultHTTPClient = &http.Client{Timeout: DefaultTimeout}
+
+// Client implements TokenClient on top of the ECR and STS APIs.
+type Client struct {
+	HTTPClient *http.Client
+
+	// endpoint replaces the regional endpoints of the APIs when set.
+	endpoint string
+}
+
+type serviceError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *serviceError) Error() string {
+	return fmt.Sprintf("ecr: %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return defaultHTTPClient
+}
+
+func (c *Client) url(prefix, region string) string {
+	if c.endpoint != "" {
+		return c.endpoint
+	}
+	host := fmt.Sprintf("%s.%s.amazonaws.com", prefix, region)
+	if strings.HasPrefix(region, "cn-") {
+		host += ".cn"
+	}
+	return "https://" + host + "/"
+}
+
+// call sends a signed POST request to an API, returning the response body.
+// The endpoint host starts with prefix, and the request is signed for
+// service, the signing name of the API, which may differ from the prefix.
+// API errors are decoded with decodeError.
+func (c *Client) call(prefix, service, region string, keys Keys, header http.Header, body []byte, decodeError func([]byte, *serviceError)) ([]byte, error) {
+	req, err := http.NewRequestWithContext(credentials.OperationContext(), http.MethodPost, c.url(prefix, region), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	signRequest(req, body, keys, region, service, time.Now())
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, credentials.ClassifyTransportError(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		svcErr := &serviceError{Status: resp.StatusCode}
+		decodeError(b, svcErr)
+		if svcErr.Message == "" {
+			svcErr.Message = strings.TrimSpace(string(b))
+		}
+		return nil, credentials.ClassifyHTTPStatus(resp.StatusCode, svcErr)
+	}
+	return b, nil
+}
+
+type authorizationData struct {
+	AuthorizationToken string  `json:"authorizationToken"`
+	ExpiresAt          float64 `json:"expiresAt"`
+}
+
+// GetAuthorizationToken calls the GetAuthorizationToken API of ECR, and
+// decodes the "AWS:<password>" token it returns.
+func (c *Client) GetAuthorizationToken(keys Keys, region string) (Token, error) {
+	header := http.Header{}
+	header.Set("Content-Type", "application/x-amz-json-1.1")
+	header.Set("X-Amz-Target", "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken")
+	b, err := c.call("api.ecr", "ecr", region, keys, header, []byte("{}"), func(b []byte, e *serviceError) {
+		var body struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(b, &body)
+		e.Code, e.Message = body.Type, body.Message
+	})
+	if err != nil {
+		return Token{}, err
+	}
+
+	var out struct {
+		AuthorizationData []authorizationData `json:"authorizationData"`
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return Token{}, fmt.Errorf("ecr: invalid GetAuthorizationToken response: %v", err)
+	}
+	if len(out.AuthorizationData) == 0 {
+		return Token{}, fmt.Errorf("ecr: no authorization data in the GetAuthorizationToken response")
+	}
+	data := out.AuthorizationData[0]
+	decoded, err := base64.StdEncoding.DecodeString(data.AuthorizationToken)
+	if err != nil || !bytes.HasPrefix(decoded, []byte(TokenUsername+":")) {
+		return Token{}, fmt.Errorf("ecr: invalid authorization token in the GetAuthorizationToken response")
+	}
+	sec := int64(data.ExpiresAt)
+	return Token{
+		Password:  string(decoded[len(TokenUsername)+1:]),
+		ExpiresAt: time.Unix(sec, int64((data.ExpiresAt-float64(sec))*1e9)),
+	}, nil
+}
+
+// AssumeRole calls the AssumeRole API of STS.
+func (c *Client) AssumeRole(keys Keys, roleARN, region string) (Keys, error) {
+	form := url.Values{}
+	form.Set("Action", "AssumeRole")
+	form.Set("Version", "2011-06-15")
+	form.Set("RoleArn", roleARN)
+	form.Set("RoleSessionName", "docker-credential-helpers")
+	header := http.Header{}
+	header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	b, err := c.call("sts", "sts", region, keys, header, []byte(form.Encode()), func(b []byte, e *serviceError) {
+		var body struct {
+			Code    string `xml:"Error>Code"`
+			Message string `xml:"Error>Message"`
+		}
+		xml.Unmarshal(b, &body)
+		e.Code, e.Message = body.Code, body.Message
+	})
+	if err != nil {
+		return Keys{}, err
+	}
+
+	var out struct {
+		AccessKeyID     string `xml:"AssumeRoleResult>Credentials>AccessKeyId"`
+		SecretAccessKey string `xml:"AssumeRoleResult>Credentials>SecretAccessKey"`
+		SessionToken    string `xml:"AssumeRoleResult>Credentials>SessionToken"`
+	}
+	if err := xml.Unmarshal(b, &out); err != nil || out.AccessKeyID == "" {
+		return Keys{}, fmt.Errorf("ecr: invalid AssumeRole response")
+	}
+	return Keys{AccessKeyID: out.AccessKeyID, SecretAccessKey: out.SecretAccessKey, SessionToken: out.SessionToken}, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// signRequest signs req following the AWS Signature Version 4 scheme. The
+// request has no query string, and every header set on it is signed.
+func signRequest(req *http.Request, body []byte, keys Keys, region, service string, now time.Time) {
+	now = now.UTC()
+	date := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", date)
+	if keys.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", keys.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.Join(v, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, strings.TrimSpace(headers[name]))
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method, path, req.URL.RawQuery, canonicalHeaders.String(), signedHeaders, sha256Hex(body),
+	}, "\n")
+	scope := strings.Join([]string{date[:8], region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", date, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+keys.SecretAccessKey), date[:8])
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		keys.AccessKeyID, scope, signedHeaders, signature))
+}
@@ -0,0 +1,108 @@
+package ecr
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+)
+
+func TestSignRequest(t *testing.T) {
+	// The get-vanilla case of the AWS Signature Version 4 test suite.
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := Keys{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signRequest(req, nil, keys, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != expected {
+		t.Fatalf("expected %s, got %s", expected, got)
+	}
+}
+
+// fakeAWS emulates the GetAuthorizationToken API of ECR and the AssumeRole
+// API of STS on a single endpoint.
+func fakeAWS(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		body, _ := ioutil.ReadAll(r.Body)
+		switch {
+		case r.Header.Get("X-Amz-Target") == "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken":
+			if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=ASIATEMP/") || !strings.Contains(auth, "/eu-west-1/ecr/aws4_request") {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `{"__type":"AccessDeniedException","message":"not authorized"}`)
+				return
+			}
+			if r.Header.Get("X-Amz-Security-Token") != "session" {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `{"__type":"UnrecognizedClientException","message":"missing session token"}`)
+				return
+			}
+			token := base64.StdEncoding.EncodeToString([]byte("AWS:minted"))
+			fmt.Fprintf(w, `{"authorizationData":[{"authorizationToken":%q,"expiresAt":1600043200.5,"proxyEndpoint":"https://123456789012.dkr.ecr.eu-west-1.amazonaws.com"}]}`, token)
+		default:
+			form, _ := url.ParseQuery(string(body))
+			if form.Get("Action") != "AssumeRole" || !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIAEXAMPLE/") {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `<ErrorResponse><Error><Code>InvalidAction</Code><Message>unexpected request</Message></Error></ErrorResponse>`)
+				return
+			}
+			if form.Get("RoleArn") != "arn:aws:iam::123456789012:role/pull" {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `<ErrorResponse><Error><Code>AccessDenied</Code><Message>not authorized to assume the role</Message></Error></ErrorResponse>`)
+				return
+			}
+			fmt.Fprint(w, `<AssumeRoleResponse><AssumeRoleResult><Credentials><AccessKeyId>ASIATEMP</AccessKeyId><SecretAccessKey>temp</SecretAccessKey><SessionToken>session</SessionToken></Credentials></AssumeRoleResult></AssumeRoleResponse>`)
+		}
+	}))
+}
+
+func TestClient(t *testing.T) {
+	server := fakeAWS(t)
+	defer server.Close()
+	client := &Client{endpoint: server.URL}
+
+	keys, err := client.AssumeRole(Keys{AccessKeyID: "AKIAEXAMPLE", SecretAccessKey: "secret"}, "arn:aws:iam::123456789012:role/pull", "eu-west-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys != (Keys{AccessKeyID: "ASIATEMP", SecretAccessKey: "temp", SessionToken: "session"}) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+	token, err := client.GetAuthorizationToken(keys, "eu-west-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Password != "minted" || !token.ExpiresAt.Equal(time.Unix(1600043200, 5e8)) {
+		t.Fatalf("unexpected token %+v", token)
+	}
+
+	_, err = client.AssumeRole(Keys{AccessKeyID: "AKIAEXAMPLE", SecretAccessKey: "secret"}, "arn:aws:iam::123456789012:role/admin", "eu-west-1")
+	if err == nil || err.Error() != "ecr: 403 AccessDenied: not authorized to assume the role" || !errors.Is(err, credentials.ErrPermissionDenied) {
+		t.Fatalf("expected an access denied error, got %v", err)
+	}
+	_, err = client.GetAuthorizationToken(Keys{AccessKeyID: "AKIAEXAMPLE", SecretAccessKey: "secret"}, "eu-west-1")
+	if err == nil || err.Error() != "ecr: 403 AccessDeniedException: not authorized" {
+		t.Fatalf("expected an access denied error, got %v", err)
+	}
+}
+
+func TestClientURL(t *testing.T) {
+	client := &Client{}
+	if u := client.url("api.ecr", "eu-west-1"); u != "https://api.ecr.eu-west-1.amazonaws.com/" {
+		t.Fatalf("unexpected ECR endpoint %s", u)
+	}
+	if u := client.url("sts", "cn-north-1"); u != "https://sts.cn-north-1.amazonaws.com.cn/" {
+		t.Fatalf("unexpected STS endpoint %s", u)
+	}
+}
@@ -0,0 +1,254 @@
+// An Amazon Elastic Container Registry (ECR) aware credential helper.
+// Credentials of ECR registries, such as
+//
+//	123456789012.dkr.ecr.eu-west-1.amazonaws.com
+//
+// are kept in another store as AWS access keys: the username is the access
+// key ID and the secret is the secret access key. Get exchanges them for a
+// docker login token with the GetAuthorizationToken API of the region of the
+// registry, and returns it with the "AWS" username. Access keys stored with
+// the MetaRoleARN metadata first assume that role with STS. Tokens are
+// cached in memory by the ECR value until RefreshMargin before they expire,
+// so they are only reused by programs serving several requests, such as
+// credentials.ServeCache: a helper process serving a single command mints a
+// token for every get. Credentials of other registries are served as they
+// are stored.
+package ecr
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/docker/docker-credential-helpers/registryurl"
+)
+
+// EnvStore is the environment variable naming the registered backend which
+// holds the access keys, when the Store of an ECR is nil.
+const EnvStore = "ECR_STORE"
+
+// MetaRoleARN is the metadata key holding the ARN of the role assumed with
+// the stored access keys, such as "arn:aws:iam::123456789012:role/pull".
+const MetaRoleARN = "aws_role_arn"
+
+// TokenUsername is the username of docker login tokens.
+const TokenUsername = "AWS"
+
+// RefreshMargin is how long before they expire tokens are minted again.
+var RefreshMargin = 5 * time.Minute
+
+// Keys are AWS access keys. The SessionToken is only set for temporary
+// keys, such as those of an assumed role.
+type Keys struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// Token is a docker login token of an ECR registry.
+type Token struct {
+	Password  string
+	ExpiresAt time.Time
+}
+
+// TokenClient is the subset of the ECR and STS APIs used by the helper.
+type TokenClient interface {
+	// GetAuthorizationToken mints a docker login token valid for the
+	// registries of a region.
+	GetAuthorizationToken(keys Keys, region string) (Token, error)
+	// AssumeRole returns temporary keys of a role.
+	AssumeRole(keys Keys, roleARN, region string) (Keys, error)
+}
+
+// registryPattern matches the hosts of ECR registries, capturing the region.
+var registryPattern = regexp.MustCompile(`^[0-9]{12}\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(?:\.cn)?$`)
+
+// Region returns the region of the ECR registry of a server URL, or false
+// when the server URL is not an ECR registry.
+func Region(serverURL string) (string, bool) {
+	u, err := registryurl.Parse(serverURL)
+	if err != nil {
+		return "", false
+	}
+	m := registryPattern.FindStringSubmatch(strings.ToLower(u.Hostname()))
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// ECR handles credentials of ECR registries on top of a store of access
+// keys. A nil Store falls back to the backend named by ECR_STORE, and a nil
+// Client to a Client sending requests to AWS, so the zero value is ready to
+// use from a credential helper binary.
+type ECR struct {
+	Store  credentials.Helper
+	Client TokenClient
+
+	now    func() time.Time
+	mu     sync.Mutex
+	tokens map[string]Token
+}
+
+func (e *ECR) store() (credentials.Helper, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.Store != nil {
+		return e.Store, nil
+	}
+	name := os.Getenv(EnvStore)
+	if name == "" {
+		return nil, fmt.Errorf("ecr: %s is not set", EnvStore)
+	}
+	store, err := credentials.NewBackend(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := store.(*ECR); ok {
+		return nil, fmt.Errorf("ecr: %s must name the backend holding the access keys", EnvStore)
+	}
+	e.Store = store
+	return store, nil
+}
+
+func (e *ECR) client() TokenClient {
+	if e.Client != nil {
+		return e.Client
+	}
+	return &Client{}
+}
+
+func (e *ECR) clock() time.Time {
+	if e.now != nil {
+		return e.now()
+	}
+	return time.Now()
+}
+
+// invalidate drops the cached tokens, since the keys they were minted with
+// may have changed.
+func (e *ECR) invalidate() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.tokens = nil
+}
+
+// Add stores the credentials in the Store. Credentials of ECR registries
+// must be access keys.
+func (e *ECR) Add(creds *credentials.Credentials) error {
+	if creds == nil {
+		return errors.New("missing credentials")
+	}
+	return e.AddWithMeta(&credentials.ExtendedCredentials{Credentials: *creds})
+}
+
+// AddWithMeta stores the credentials in the Store, along with the
+// MetaRoleARN metadata of access keys assuming a role.
+func (e *ECR) AddWithMeta(creds *credentials.ExtendedCredentials) error {
+	if creds == nil {
+		return errors.New("missing credentials")
+	}
+	if _, ok := Region(creds.ServerURL); ok && creds.Username == TokenUsername {
+		return errors.New("ecr: expected AWS access keys, not a docker login token")
+	}
+	store, err := e.store()
+	if err != nil {
+		return err
+	}
+	defer e.invalidate()
+	return credentials.AddWithMeta(store, creds)
+}
+
+// Delete removes the credentials of a server URL from the Store.
+func (e *ECR) Delete(serverURL string) error {
+	store, err := e.store()
+	if err != nil {
+		return err
+	}
+	defer e.invalidate()
+	return store.Delete(serverURL)
+}
+
+// Get returns a docker login token for ECR registries, and the stored
+// credentials for other registries.
+func (e *ECR) Get(serverURL string) (string, string, error) {
+	creds, err := e.GetWithMeta(serverURL)
+	if err != nil {
+		return "", "", err
+	}
+	return creds.Username, creds.Secret, nil
+}
+
+// GetWithMeta works like Get, returning the stored metadata along with the
+// credentials.
+func (e *ECR) GetWithMeta(serverURL string) (*credentials.ExtendedCredentials, error) {
+	store, err := e.store()
+	if err != nil {
+		return nil, err
+	}
+	creds, err := credentials.GetWithMeta(store, serverURL)
+	if err != nil {
+		return nil, err
+	}
+	region, ok := Region(serverURL)
+	if !ok {
+		return creds, nil
+	}
+
+	keys := Keys{AccessKeyID: creds.Username, SecretAccessKey: creds.Secret}
+	roleARN := creds.Metadata[MetaRoleARN]
+	key := strings.Join([]string{region, keys.AccessKeyID, roleARN}, "\x00")
+	e.mu.Lock()
+	token, ok := e.tokens[key]
+	e.mu.Unlock()
+	if !ok || !e.clock().Add(RefreshMargin).Before(token.ExpiresAt) {
+		if token, err = e.mint(keys, roleARN, region); err != nil {
+			return nil, err
+		}
+		e.mu.Lock()
+		if e.tokens == nil {
+			e.tokens = map[string]Token{}
+		}
+		e.tokens[key] = token
+		e.mu.Unlock()
+	}
+	creds.Username, creds.Secret = TokenUsername, token.Password
+	return creds, nil
+}
+
+// mint exchanges access keys for a docker login token, assuming a role
+// first if roleARN is set.
+func (e *ECR) mint(keys Keys, roleARN, region string) (Token, error) {
+	client := e.client()
+	if roleARN != "" {
+		var err error
+		if keys, err = client.AssumeRole(keys, roleARN, region); err != nil {
+			return Token{}, err
+		}
+	}
+	return client.GetAuthorizationToken(keys, region)
+}
+
+// List returns the server URLs of the Store, with the username of the
+// tokens for ECR registries.
+func (e *ECR) List() (map[string]string, error) {
+	store, err := e.store()
+	if err != nil {
+		return nil, err
+	}
+	accts, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	for serverURL := range accts {
+		if _, ok := Region(serverURL); ok {
+			accts[serverURL] = TokenUsername
+		}
+	}
+	return accts, nil
+}
@@ -0,0 +1,210 @@
+package ecr
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+)
+
+// memoryStore is an in-memory store of access keys and their metadata.
+type memoryStore struct {
+	creds map[string]credentials.ExtendedCredentials
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{creds: map[string]credentials.ExtendedCredentials{}}
+}
+
+func (s *memoryStore) Add(creds *credentials.Credentials) error {
+	return s.AddWithMeta(&credentials.ExtendedCredentials{Credentials: *creds})
+}
+
+func (s *memoryStore) AddWithMeta(creds *credentials.ExtendedCredentials) error {
+	s.creds[creds.ServerURL] = *creds
+	return nil
+}
+
+func (s *memoryStore) Delete(serverURL string) error {
+	delete(s.creds, serverURL)
+	return nil
+}
+
+func (s *memoryStore) Get(serverURL string) (string, string, error) {
+	creds, err := s.GetWithMeta(serverURL)
+	if err != nil {
+		return "", "", err
+	}
+	return creds.Username, creds.Secret, nil
+}
+
+func (s *memoryStore) GetWithMeta(serverURL string) (*credentials.ExtendedCredentials, error) {
+	creds, ok := s.creds[serverURL]
+	if !ok {
+		return nil, credentials.NewErrCredentialsNotFound()
+	}
+	return &creds, nil
+}
+
+func (s *memoryStore) List() (map[string]string, error) {
+	accts := map[string]string{}
+	for serverURL, creds := range s.creds {
+		accts[serverURL] = creds.Username
+	}
+	return accts, nil
+}
+
+// fakeClient mints numbered tokens valid for 12 hours.
+type fakeClient struct {
+	now     time.Time
+	minted  []Keys
+	assumed []string
+	err     error
+}
+
+func (c *fakeClient) GetAuthorizationToken(keys Keys, region string) (Token, error) {
+	if c.err != nil {
+		return Token{}, c.err
+	}
+	c.minted = append(c.minted, keys)
+	return Token{Password: region + "-token" + string(rune('0'+len(c.minted))), ExpiresAt: c.now.Add(12 * time.Hour)}, nil
+}
+
+func (c *fakeClient) AssumeRole(keys Keys, roleARN, region string) (Keys, error) {
+	c.assumed = append(c.assumed, keys.AccessKeyID+" "+roleARN)
+	return Keys{AccessKeyID: "ASIATEMP", SecretAccessKey: "temp", SessionToken: "session"}, nil
+}
+
+func TestRegion(t *testing.T) {
+	tests := []struct {
+		serverURL string
+		region    string
+		ok        bool
+	}{
+		{serverURL: "123456789012.dkr.ecr.eu-west-1.amazonaws.com", region: "eu-west-1", ok: true},
+		{serverURL: "https://123456789012.dkr.ecr.us-east-1.amazonaws.com/v2/", region: "us-east-1", ok: true},
+		{serverURL: "123456789012.dkr.ecr-fips.us-gov-west-1.amazonaws.com", region: "us-gov-west-1", ok: true},
+		{serverURL: "123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn", region: "cn-north-1", ok: true},
+		{serverURL: "public.ecr.aws", ok: false},
+		{serverURL: "https://index.docker.io/v1/", ok: false},
+		{serverURL: "123456789012.dkr.ecr.eu-west-1.amazonaws.com.example.com", ok: false},
+	}
+	for _, te := range tests {
+		region, ok := Region(te.serverURL)
+		if region != te.region || ok != te.ok {
+			t.Errorf("%s: expected %q, %v, got %q, %v", te.serverURL, te.region, te.ok, region, ok)
+		}
+	}
+}
+
+func TestECR(t *testing.T) {
+	serverURL := "123456789012.dkr.ecr.eu-west-1.amazonaws.com"
+	now := time.Unix(1600000000, 0)
+	client := &fakeClient{now: now}
+	store := newMemoryStore()
+	helper := &ECR{Store: store, Client: client, now: func() time.Time { return now }}
+
+	if err := helper.Add(&credentials.Credentials{ServerURL: serverURL, Username: "AKIAEXAMPLE", Secret: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := helper.Add(&credentials.Credentials{ServerURL: "quay.io", Username: "foo", Secret: "bar"}); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(expected string) {
+		t.Helper()
+		username, secret, err := helper.Get(serverURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if username != "AWS" || secret != expected {
+			t.Fatalf("expected AWS/%s, got %s/%s", expected, username, secret)
+		}
+	}
+	get("eu-west-1-token1")
+	get("eu-west-1-token1")
+	if len(client.minted) != 1 || client.minted[0] != (Keys{AccessKeyID: "AKIAEXAMPLE", SecretAccessKey: "secret"}) {
+		t.Fatalf("expected a single token minted with the stored keys, got %v", client.minted)
+	}
+
+	// Tokens are minted again shortly before they expire.
+	now = now.Add(12*time.Hour - RefreshMargin)
+	client.now = now
+	get("eu-west-1-token2")
+
+	// Other registries are served as they are stored.
+	if username, secret, err := helper.Get("quay.io"); err != nil || username != "foo" || secret != "bar" {
+		t.Fatalf("expected the stored credentials, got %s/%s, %v", username, secret, err)
+	}
+	accts, err := helper.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accts) != 2 || accts[serverURL] != "AWS" || accts["quay.io"] != "foo" {
+		t.Fatalf("unexpected list result: %v", accts)
+	}
+
+	// Storing keys with a role assumes it before minting tokens.
+	err = helper.AddWithMeta(&credentials.ExtendedCredentials{
+		Credentials: credentials.Credentials{ServerURL: serverURL, Username: "AKIAEXAMPLE", Secret: "secret"},
+		Metadata:    map[string]string{MetaRoleARN: "arn:aws:iam::123456789012:role/pull"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	get("eu-west-1-token3")
+	if len(client.assumed) != 1 || client.assumed[0] != "AKIAEXAMPLE arn:aws:iam::123456789012:role/pull" {
+		t.Fatalf("expected the role to be assumed with the stored keys, got %v", client.assumed)
+	}
+	if keys := client.minted[2]; keys.AccessKeyID != "ASIATEMP" || keys.SessionToken != "session" {
+		t.Fatalf("expected the token to be minted with the keys of the role, got %v", keys)
+	}
+
+	if err := helper.Add(&credentials.Credentials{ServerURL: serverURL, Username: "AWS", Secret: "token"}); err == nil {
+		t.Fatal("expected a docker login token to be rejected")
+	}
+
+	if err := helper.Delete(serverURL); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := helper.Get(serverURL); !credentials.IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected not found after delete, got %v", err)
+	}
+}
+
+func TestECRMintError(t *testing.T) {
+	serverURL := "123456789012.dkr.ecr.eu-west-1.amazonaws.com"
+	client := &fakeClient{err: credentials.ClassifyHTTPStatus(403, errors.New("ecr: 403 AccessDeniedException: denied"))}
+	store := newMemoryStore()
+	store.Add(&credentials.Credentials{ServerURL: serverURL, Username: "AKIAEXAMPLE", Secret: "secret"})
+	helper := &ECR{Store: store, Client: client}
+
+	if _, _, err := helper.Get(serverURL); !errors.Is(err, credentials.ErrPermissionDenied) {
+		t.Fatalf("expected a permission denied error, got %v", err)
+	}
+}
+
+// registerLoop registers a backend looping back to ecr once per process,
+// since the registry cannot be reset from another package.
+var registerLoop sync.Once
+
+func TestECRStoreFromEnv(t *testing.T) {
+	defer os.Setenv(EnvStore, os.Getenv(EnvStore))
+	os.Setenv(EnvStore, "")
+	if _, err := (&ECR{}).List(); err == nil || err.Error() != "ecr: ECR_STORE is not set" {
+		t.Fatalf("expected a missing configuration error, got %v", err)
+	}
+
+	registerLoop.Do(func() {
+		credentials.Register("ecr-loop", func() (credentials.Helper, error) {
+			return &ECR{}, nil
+		})
+	})
+	os.Setenv(EnvStore, "ecr-loop")
+	if _, err := (&ECR{}).List(); err == nil || err.Error() != "ecr: ECR_STORE must name the backend holding the access keys" {
+		t.Fatalf("expected a store looping back to ecr to be rejected, got %v", err)
+	}
+}
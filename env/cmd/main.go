@@ -0,0 +1,10 @@
+package main
+
+import (
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/docker/docker-credential-helpers/env"
+)
+
+func main() {
+	credentials.Serve(env.Env{})
+}
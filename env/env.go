@@ -0,0 +1,148 @@
+// An environment variables based, read-only credential helper, meant for
+// ephemeral CI jobs that receive their registry credentials as secrets.
+// The credentials of a registry host are read from the variables
+//
+//	DOCKER_CREDS_<HOST>_USERNAME
+//	DOCKER_CREDS_<HOST>_PASSWORD
+//
+// where <HOST> is the host (and port, if any) of the server URL in upper
+// case, with each '.' replaced by "_", each '-' by "__" and the ':' before
+// the port by "___". For instance, the credentials of
+// my-registry.example.com:5000 are read from
+// DOCKER_CREDS_MY__REGISTRY_EXAMPLE_COM___5000_USERNAME and
+// DOCKER_CREDS_MY__REGISTRY_EXAMPLE_COM___5000_PASSWORD.
+package env
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/docker/docker-credential-helpers/registryurl"
+)
+
+const (
+	varPrefix      = "DOCKER_CREDS_"
+	usernameSuffix = "_USERNAME"
+	passwordSuffix = "_PASSWORD"
+)
+
+// errReadOnly is returned when storing or erasing credentials, which the
+// environment does not support.
+var errReadOnly = fmt.Errorf("env: credentials are read from the environment: %w", credentials.ErrReadOnly)
+
+// Env handles secrets using environment variables as a read-only store.
+type Env struct{}
+
+// varName returns the name of the variable holding the username or password
+// of a registry host, depending on suffix.
+func varName(host, suffix string) string {
+	var b strings.Builder
+	b.WriteString(varPrefix)
+	for _, r := range strings.ToUpper(host) {
+		switch r {
+		case '.':
+			b.WriteString("_")
+		case '-':
+			b.WriteString("__")
+		case ':':
+			b.WriteString("___")
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteString(suffix)
+	return b.String()
+}
+
+// decodeHost reverses the encoding of a host in a variable name. Host labels
+// cannot start or end with '-', so a run of one underscore is a '.', a run of
+// three underscores is a ':' and an even run encodes hyphens.
+func decodeHost(encoded string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(encoded); {
+		if encoded[i] != '_' {
+			b.WriteByte(encoded[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(encoded) && encoded[j] == '_' {
+			j++
+		}
+		switch n := j - i; {
+		case n == 1:
+			b.WriteByte('.')
+		case n == 3:
+			b.WriteByte(':')
+		case n%2 == 0:
+			b.WriteString(strings.Repeat("-", n/2))
+		default:
+			return "", false
+		}
+		i = j
+	}
+	return strings.ToLower(b.String()), b.Len() > 0
+}
+
+// Add is not supported and returns an error wrapping
+// credentials.ErrReadOnly.
+func (h Env) Add(creds *credentials.Credentials) error {
+	return errReadOnly
+}
+
+// Delete is not supported and returns an error wrapping
+// credentials.ErrReadOnly.
+func (h Env) Delete(serverURL string) error {
+	return errReadOnly
+}
+
+// Get returns the username and secret to use for a given registry server URL.
+func (h Env) Get(serverURL string) (string, string, error) {
+	if serverURL == "" {
+		return "", "", errors.New("missing server url")
+	}
+
+	u, err := registryurl.Parse(serverURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	username, ok := os.LookupEnv(varName(u.Host, usernameSuffix))
+	if !ok {
+		return "", "", credentials.NewErrCredentialsNotFound()
+	}
+	secret, ok := os.LookupEnv(varName(u.Host, passwordSuffix))
+	if !ok {
+		return "", "", credentials.NewErrCredentialsNotFound()
+	}
+	return username, secret, nil
+}
+
+// List returns the registry hosts and corresponding usernames found in the
+// environment.
+func (h Env) List() (map[string]string, error) {
+	resp := map[string]string{}
+	for _, kv := range os.Environ() {
+		i := strings.Index(kv, "=")
+		if i < 0 {
+			continue
+		}
+		name, value := kv[:i], kv[i+1:]
+		if !strings.HasPrefix(name, varPrefix) || !strings.HasSuffix(name, usernameSuffix) {
+			continue
+		}
+		encoded := strings.TrimSuffix(strings.TrimPrefix(name, varPrefix), usernameSuffix)
+		if _, ok := os.LookupEnv(varPrefix + encoded + passwordSuffix); !ok {
+			continue
+		}
+		host, ok := decodeHost(encoded)
+		if !ok {
+			continue
+		}
+		resp[host] = value
+	}
+	return resp, nil
+}
@@ -0,0 +1,92 @@
+package env
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+)
+
+func setenv(t *testing.T, vars map[string]string) func() {
+	for k, v := range vars {
+		if err := os.Setenv(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return func() {
+		for k := range vars {
+			os.Unsetenv(k)
+		}
+	}
+}
+
+func TestVarName(t *testing.T) {
+	tests := []struct {
+		host string
+		name string
+	}{
+		{host: "registry.example.com", name: "DOCKER_CREDS_REGISTRY_EXAMPLE_COM_USERNAME"},
+		{host: "my-registry.example.com:5000", name: "DOCKER_CREDS_MY__REGISTRY_EXAMPLE_COM___5000_USERNAME"},
+		{host: "xn--bcher-kva.example", name: "DOCKER_CREDS_XN____BCHER__KVA_EXAMPLE_USERNAME"},
+	}
+	for _, te := range tests {
+		name := varName(te.host, usernameSuffix)
+		if name != te.name {
+			t.Errorf("expected %s for %s, got %s", te.name, te.host, name)
+		}
+		encoded := name[len(varPrefix) : len(name)-len(usernameSuffix)]
+		if host, ok := decodeHost(encoded); !ok || host != te.host {
+			t.Errorf("expected %s to decode to %s, got %s", encoded, te.host, host)
+		}
+	}
+}
+
+func TestEnvHelper(t *testing.T) {
+	defer setenv(t, map[string]string{
+		"DOCKER_CREDS_REGISTRY_EXAMPLE_COM_USERNAME":            "foo",
+		"DOCKER_CREDS_REGISTRY_EXAMPLE_COM_PASSWORD":            "bar",
+		"DOCKER_CREDS_MY__REGISTRY_EXAMPLE_COM___5000_USERNAME": "baz",
+		"DOCKER_CREDS_MY__REGISTRY_EXAMPLE_COM___5000_PASSWORD": "qux",
+		"DOCKER_CREDS_NOPASSWORD_EXAMPLE_COM_USERNAME":          "incomplete",
+	})()
+
+	helper := Env{}
+
+	username, secret, err := helper.Get("https://registry.example.com/v2/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if username != "foo" || secret != "bar" {
+		t.Fatalf("unexpected credentials %s:%s", username, secret)
+	}
+
+	username, secret, err = helper.Get("My-Registry.example.com:5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if username != "baz" || secret != "qux" {
+		t.Fatalf("unexpected credentials %s:%s", username, secret)
+	}
+
+	for _, serverURL := range []string{"https://unknown.example.com", "nopassword.example.com"} {
+		if _, _, err := helper.Get(serverURL); !credentials.IsErrCredentialsNotFound(err) {
+			t.Fatalf("expected not found error for %s, got %v", serverURL, err)
+		}
+	}
+
+	credsList, err := helper.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(credsList) != 2 || credsList["registry.example.com"] != "foo" || credsList["my-registry.example.com:5000"] != "baz" {
+		t.Fatalf("unexpected list result: %v", credsList)
+	}
+
+	if err := helper.Add(&credentials.Credentials{ServerURL: "registry.example.com", Username: "foo", Secret: "bar"}); !errors.Is(err, credentials.ErrReadOnly) {
+		t.Fatalf("expected read-only error, got %v", err)
+	}
+	if err := helper.Delete("registry.example.com"); !errors.Is(err, credentials.ErrReadOnly) {
+		t.Fatalf("expected read-only error, got %v", err)
+	}
+}
@@ -0,0 +1,448 @@
+// A command line based credential helper, which stores credentials with an
+// arbitrary password manager by running the commands described in a
+// configuration file. For instance, this configuration stores credentials
+// with `pass`, keeping the username on the second line of each entry:
+//
+//	{
+//	  "get": {"args": ["pass", "show", "docker/{host}"], "format": "fields", "username_key": "login"},
+//	  "add": {"args": ["pass", "insert", "-m", "-f", "docker/{host}"], "stdin": "{secret}\nlogin: {user}\n"},
+//	  "delete": {"args": ["pass", "rm", "-f", "docker/{host}"]},
+//	  "not_found_output": "is not in the password store"
+//	}
+//
+// Commands are run directly, without a shell. Each argument of a command is
+// expanded into exactly one argument, so placeholder values cannot inject
+// arguments, and a value can only start with '-' where the argument does.
+// Values holding ".." path segments are rejected, so that entries named
+// after them cannot escape a directory such as docker/.
+package exechelper
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/docker/docker-credential-helpers/registryurl"
+)
+
+// ConfigEnv is the environment variable holding the path of the
+// configuration file used by a zero ExecHelper.
+const ConfigEnv = "DOCKER_CREDS_EXEC_CONFIG"
+
+// Placeholders expanded in the arguments and standard input of commands.
+// HostPlaceholder is the host of the server URL, with its port if any, such
+// as "registry.example.com:5000": unlike the server URL, it is the same for
+// every form of URL of a registry and holds no '/', which suits entry names.
+const (
+	URLPlaceholder    = "{url}"
+	HostPlaceholder   = "{host}"
+	UserPlaceholder   = "{user}"
+	SecretPlaceholder = "{secret}"
+)
+
+// Format describes how the output of a get or list command is parsed.
+type Format string
+
+const (
+	// FormatLines is the default format. Get outputs the username on the
+	// first line and the secret on the second one, and list outputs one
+	// entry per line, with the server URL and the username separated by a
+	// tab.
+	FormatLines Format = "lines"
+	// FormatFields parses get outputs made of the secret on the first line,
+	// followed by "key: value" lines. The username is the value of the
+	// UsernameKey line, and defaults to "username". Keys are case-insensitive.
+	FormatFields Format = "fields"
+	// FormatJSON parses get outputs made of a JSON object, holding the
+	// username and the secret in the UsernameKey and SecretKey members, which
+	// default to "Username" and "Secret". List outputs a JSON object mapping
+	// server URLs to usernames, like the list action of credential helpers.
+	FormatJSON Format = "json"
+)
+
+// Command describes a command run by an ExecHelper.
+type Command struct {
+	// Args holds the program to run and its arguments, which may contain
+	// placeholders. The program itself cannot contain placeholders.
+	Args []string `json:"args"`
+	// Stdin is written to the standard input of the command, after
+	// expanding its placeholders. Secrets should be passed here rather than
+	// in Args, which other users of the system can see.
+	Stdin string `json:"stdin,omitempty"`
+	// Format is the format of the output of get and list commands.
+	Format Format `json:"format,omitempty"`
+	// UsernameKey and SecretKey name the values holding the username and
+	// the secret in the FormatFields and FormatJSON formats.
+	UsernameKey string `json:"username_key,omitempty"`
+	SecretKey   string `json:"secret_key,omitempty"`
+}
+
+// configured returns whether the command has been set.
+func (c Command) configured() bool {
+	return len(c.Args) > 0
+}
+
+// ExecHelper handles secrets by running the commands of a password manager.
+// The zero value reads its configuration from the JSON file named by the
+// DOCKER_CREDS_EXEC_CONFIG environment variable.
+type ExecHelper struct {
+	GetCommand    Command `json:"get"`
+	AddCommand    Command `json:"add"`
+	DeleteCommand Command `json:"delete"`
+	ListCommand   Command `json:"list"`
+	// NotFoundExitCodes and NotFoundOutput identify failed get and delete
+	// commands caused by missing credentials, by their exit code or by a
+	// message found in their output. An empty get output is also reported as
+	// missing credentials.
+	NotFoundExitCodes []int  `json:"not_found_exit_codes,omitempty"`
+	NotFoundOutput    string `json:"not_found_output,omitempty"`
+	// Runner runs the commands. It defaults to running them as processes.
+	Runner Runner `json:"-"`
+}
+
+// Load reads and validates an ExecHelper configuration.
+func Load(r io.Reader) (*ExecHelper, error) {
+	var h ExecHelper
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&h); err != nil {
+		return nil, fmt.Errorf("exechelper: invalid configuration: %v", err)
+	}
+	if err := h.validate(); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// LoadFile reads and validates the ExecHelper configuration in a file.
+func LoadFile(path string) (*ExecHelper, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+func (h ExecHelper) validate() error {
+	commands := []struct {
+		name    string
+		cmd     Command
+		formats []Format
+	}{
+		{"get", h.GetCommand, []Format{FormatLines, FormatFields, FormatJSON}},
+		{"add", h.AddCommand, nil},
+		{"delete", h.DeleteCommand, nil},
+		{"list", h.ListCommand, []Format{FormatLines, FormatJSON}},
+	}
+	configured := false
+	for _, c := range commands {
+		if !c.cmd.configured() {
+			if c.cmd.Stdin != "" || c.cmd.Format != "" {
+				return fmt.Errorf("exechelper: invalid configuration: %s command has no args", c.name)
+			}
+			continue
+		}
+		configured = true
+		if strings.Contains(c.cmd.Args[0], "{") {
+			return fmt.Errorf("exechelper: invalid configuration: %s program cannot contain placeholders", c.name)
+		}
+		if c.cmd.Format == "" {
+			continue
+		}
+		valid := false
+		for _, f := range c.formats {
+			valid = valid || c.cmd.Format == f
+		}
+		if !valid {
+			return fmt.Errorf("exechelper: invalid configuration: unsupported %s format %q", c.name, c.cmd.Format)
+		}
+	}
+	if !configured {
+		return errors.New("exechelper: invalid configuration: no command configured")
+	}
+	return nil
+}
+
+// config returns the helper to use, which is read from ConfigEnv for the
+// zero value.
+func (h ExecHelper) config() (*ExecHelper, error) {
+	if h.GetCommand.configured() || h.AddCommand.configured() || h.DeleteCommand.configured() || h.ListCommand.configured() {
+		return &h, nil
+	}
+	path := os.Getenv(ConfigEnv)
+	if path == "" {
+		return nil, fmt.Errorf("exechelper: no commands configured, set %s", ConfigEnv)
+	}
+	c, err := LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c.Runner = h.Runner
+	return c, nil
+}
+
+// checkValue rejects placeholder values which could alter the commands they
+// are expanded into.
+func checkValue(name, value string) error {
+	for _, r := range value {
+		if r < ' ' || r == 0x7f {
+			return fmt.Errorf("exechelper: %s contains control characters", name)
+		}
+	}
+	return nil
+}
+
+// checkPath rejects placeholder values holding ".." path segments, which
+// would let the entries named after them escape their directory.
+func checkPath(name, value string) error {
+	segments := strings.FieldsFunc(value, func(r rune) bool { return r == '/' || r == '\\' })
+	for _, segment := range segments {
+		if segment == ".." {
+			return fmt.Errorf("exechelper: %s contains a .. path segment", name)
+		}
+	}
+	return nil
+}
+
+// host returns the value of HostPlaceholder for a server URL, which is
+// empty for commands without a server URL, such as list.
+func host(serverURL string) (string, error) {
+	if serverURL == "" {
+		return "", nil
+	}
+	u, err := registryurl.Parse(serverURL)
+	if err != nil {
+		return "", fmt.Errorf("exechelper: invalid server URL: %v", err)
+	}
+	return u.Host, nil
+}
+
+// expand expands the placeholders of a command. Values are substituted in a
+// single pass, so placeholders found in values are kept verbatim.
+func expand(cmd Command, creds *credentials.Credentials) ([]string, string, error) {
+	hostValue := ""
+	if strings.Contains(strings.Join(cmd.Args, " ")+cmd.Stdin, HostPlaceholder) {
+		var err error
+		if hostValue, err = host(creds.ServerURL); err != nil {
+			return nil, "", err
+		}
+	}
+	for _, v := range []struct{ name, value string }{
+		{"server URL", creds.ServerURL},
+		{"host", hostValue},
+		{"username", creds.Username},
+		{"secret", creds.Secret},
+	} {
+		if err := checkValue(v.name, v.value); err != nil {
+			return nil, "", err
+		}
+		// Secrets are not used to name entries, and may hold anything.
+		if v.name == "secret" {
+			continue
+		}
+		if err := checkPath(v.name, v.value); err != nil {
+			return nil, "", err
+		}
+	}
+
+	r := strings.NewReplacer(URLPlaceholder, creds.ServerURL, HostPlaceholder, hostValue, UserPlaceholder, creds.Username, SecretPlaceholder, creds.Secret)
+	args := make([]string, len(cmd.Args))
+	args[0] = cmd.Args[0]
+	for i, arg := range cmd.Args[1:] {
+		expanded := r.Replace(arg)
+		if strings.HasPrefix(expanded, "-") && !strings.HasPrefix(arg, "-") {
+			return nil, "", fmt.Errorf("exechelper: argument %q would be expanded into an option", arg)
+		}
+		args[i+1] = expanded
+	}
+	return args, r.Replace(cmd.Stdin), nil
+}
+
+// run expands and runs a command. It returns ErrCredentialsNotFound when the
+// command reports missing credentials.
+func (h *ExecHelper) run(cmd Command, creds *credentials.Credentials) ([]byte, error) {
+	args, stdin, err := expand(cmd, creds)
+	if err != nil {
+		return nil, err
+	}
+
+	runner := h.Runner
+	if runner == nil {
+		runner = ProcessRunner{}
+	}
+	res, err := runner.Run(args[0], args[1:], strings.NewReader(stdin))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", args[0], err)
+	}
+	if res.ExitCode == 0 {
+		return res.Stdout, nil
+	}
+
+	for _, code := range h.NotFoundExitCodes {
+		if res.ExitCode == code {
+			return nil, credentials.NewErrCredentialsNotFound()
+		}
+	}
+	if h.NotFoundOutput != "" && (bytes.Contains(res.Stderr, []byte(h.NotFoundOutput)) || bytes.Contains(res.Stdout, []byte(h.NotFoundOutput))) {
+		return nil, credentials.NewErrCredentialsNotFound()
+	}
+	return nil, fmt.Errorf("%s: exit status %d: %s", args[0], res.ExitCode, strings.TrimSpace(string(res.Stderr)))
+}
+
+// unsupported reports an action without a configured command.
+func unsupported(action string) error {
+	return fmt.Errorf("exechelper: no %s command configured", action)
+}
+
+// Add adds new credentials to the store.
+func (h ExecHelper) Add(creds *credentials.Credentials) error {
+	if creds == nil {
+		return errors.New("missing credentials")
+	}
+	c, err := h.config()
+	if err != nil {
+		return err
+	}
+	if !c.AddCommand.configured() {
+		return unsupported("add")
+	}
+	_, err = c.run(c.AddCommand, creds)
+	return err
+}
+
+// Delete removes credentials from the store.
+func (h ExecHelper) Delete(serverURL string) error {
+	if serverURL == "" {
+		return errors.New("missing server url")
+	}
+	c, err := h.config()
+	if err != nil {
+		return err
+	}
+	if !c.DeleteCommand.configured() {
+		return unsupported("delete")
+	}
+	_, err = c.run(c.DeleteCommand, &credentials.Credentials{ServerURL: serverURL})
+	return err
+}
+
+// Get returns the username and secret to use for a given registry server URL.
+func (h ExecHelper) Get(serverURL string) (string, string, error) {
+	if serverURL == "" {
+		return "", "", errors.New("missing server url")
+	}
+	c, err := h.config()
+	if err != nil {
+		return "", "", err
+	}
+	if !c.GetCommand.configured() {
+		return "", "", unsupported("get")
+	}
+	out, err := c.run(c.GetCommand, &credentials.Credentials{ServerURL: serverURL})
+	if err != nil {
+		return "", "", err
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return "", "", credentials.NewErrCredentialsNotFound()
+	}
+	return parseGet(c.GetCommand, out)
+}
+
+// List returns the stored server URLs and their associated usernames.
+func (h ExecHelper) List() (map[string]string, error) {
+	c, err := h.config()
+	if err != nil {
+		return nil, err
+	}
+	if !c.ListCommand.configured() {
+		return nil, unsupported("list")
+	}
+	out, err := c.run(c.ListCommand, &credentials.Credentials{})
+	if err != nil {
+		return nil, err
+	}
+	return parseList(c.ListCommand, out)
+}
+
+func parseGet(cmd Command, out []byte) (string, string, error) {
+	switch cmd.Format {
+	case FormatJSON:
+		usernameKey, secretKey := orDefault(cmd.UsernameKey, "Username"), orDefault(cmd.SecretKey, "Secret")
+		var values map[string]interface{}
+		if err := json.Unmarshal(out, &values); err != nil {
+			return "", "", fmt.Errorf("exechelper: invalid get output: %v", err)
+		}
+		username, _ := values[usernameKey].(string)
+		secret, ok := values[secretKey].(string)
+		if !ok {
+			return "", "", fmt.Errorf("exechelper: invalid get output: no %q string member", secretKey)
+		}
+		return username, secret, nil
+	case FormatFields:
+		usernameKey := orDefault(cmd.UsernameKey, "username")
+		lines := splitLines(out)
+		var username string
+		for _, line := range lines[1:] {
+			i := strings.Index(line, ":")
+			if i >= 0 && strings.EqualFold(strings.TrimSpace(line[:i]), usernameKey) {
+				username = strings.TrimSpace(line[i+1:])
+				break
+			}
+		}
+		return username, lines[0], nil
+	default:
+		lines := splitLines(out)
+		if len(lines) < 2 {
+			return "", "", errors.New("exechelper: invalid get output: expected the username and the secret on two lines")
+		}
+		return lines[0], lines[1], nil
+	}
+}
+
+func parseList(cmd Command, out []byte) (map[string]string, error) {
+	resp := map[string]string{}
+	if cmd.Format == FormatJSON {
+		if err := json.Unmarshal(out, &resp); err != nil {
+			return nil, fmt.Errorf("exechelper: invalid list output: %v", err)
+		}
+		return resp, nil
+	}
+	for _, line := range splitLines(out) {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.SplitN(line, "\t", 2)
+		if len(fields) == 1 {
+			fields = append(fields, "")
+		}
+		resp[fields[0]] = fields[1]
+	}
+	return resp, nil
+}
+
+// splitLines splits an output into lines, without their line endings.
+func splitLines(out []byte) []string {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimRight(scanner.Text(), "\r"))
+	}
+	if len(lines) == 0 {
+		lines = []string{""}
+	}
+	return lines
+}
+
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,339 @@
+package exechelper
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+)
+
+// fakeVault emulates a password manager CLI, "vault", with the commands
+//
+//	vault show <key>          prints "<secret>\nuser: <username>"
+//	vault put <key>           reads "<username>\n<secret>" on stdin
+//	vault rm <key>
+//	vault ls                  prints "<key>\t<username>" lines
+type fakeVault struct {
+	entries map[string][2]string
+	calls   [][]string
+	stdins  []string
+}
+
+func newFakeVault() *fakeVault {
+	return &fakeVault{entries: map[string][2]string{}}
+}
+
+func (v *fakeVault) Run(name string, args []string, stdin io.Reader) (Result, error) {
+	if name != "vault" {
+		return Result{}, fmt.Errorf("executable file not found in $PATH")
+	}
+	in, _ := ioutil.ReadAll(stdin)
+	v.calls = append(v.calls, append([]string{name}, args...))
+	v.stdins = append(v.stdins, string(in))
+
+	if len(args) == 0 {
+		return Result{Stderr: []byte("usage: vault <command>"), ExitCode: 2}, nil
+	}
+	switch args[0] {
+	case "show", "rm":
+		if len(args) != 2 {
+			return Result{Stderr: []byte("usage: vault " + args[0] + " <key>"), ExitCode: 2}, nil
+		}
+		e, ok := v.entries[args[1]]
+		if !ok {
+			return Result{Stderr: []byte("vault: no entry " + args[1]), ExitCode: 1}, nil
+		}
+		if args[0] == "rm" {
+			delete(v.entries, args[1])
+			return Result{}, nil
+		}
+		return Result{Stdout: []byte(e[1] + "\nuser: " + e[0] + "\n")}, nil
+	case "put":
+		lines := strings.SplitN(string(in), "\n", 2)
+		if len(args) != 2 || len(lines) != 2 {
+			return Result{Stderr: []byte("usage: vault put <key>"), ExitCode: 2}, nil
+		}
+		v.entries[args[1]] = [2]string{lines[0], lines[1]}
+		return Result{}, nil
+	case "ls":
+		var out strings.Builder
+		for k, e := range v.entries {
+			fmt.Fprintf(&out, "%s\t%s\n", k, e[0])
+		}
+		return Result{Stdout: []byte(out.String())}, nil
+	}
+	return Result{Stderr: []byte("vault: unknown command " + args[0]), ExitCode: 2}, nil
+}
+
+const vaultConfig = `{
+	"get": {"args": ["vault", "show", "{url}"], "format": "fields", "username_key": "user"},
+	"add": {"args": ["vault", "put", "{url}"], "stdin": "{user}\n{secret}"},
+	"delete": {"args": ["vault", "rm", "{url}"]},
+	"list": {"args": ["vault", "ls"]},
+	"not_found_output": "no entry"
+}`
+
+func newVaultHelper(t *testing.T) (*ExecHelper, *fakeVault) {
+	h, err := Load(strings.NewReader(vaultConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := newFakeVault()
+	h.Runner = v
+	return h, v
+}
+
+func TestExecHelper(t *testing.T) {
+	h, v := newVaultHelper(t)
+
+	creds := &credentials.Credentials{ServerURL: "https://registry.example.com", Username: "foo", Secret: "bar"}
+	if err := h.Add(creds); err != nil {
+		t.Fatal(err)
+	}
+	if got := v.stdins[len(v.stdins)-1]; got != "foo\nbar" {
+		t.Fatalf("expected the credentials on stdin, got %q", got)
+	}
+	for _, arg := range v.calls[len(v.calls)-1] {
+		if strings.Contains(arg, "bar") {
+			t.Fatalf("expected the secret not to be passed as an argument, got %v", v.calls[len(v.calls)-1])
+		}
+	}
+
+	username, secret, err := h.Get(creds.ServerURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if username != "foo" || secret != "bar" {
+		t.Fatalf("expected foo/bar, got %s/%s", username, secret)
+	}
+
+	list, err := h.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[creds.ServerURL] != "foo" {
+		t.Fatalf("expected one entry for %s, got %v", creds.ServerURL, list)
+	}
+
+	if err := h.Delete(creds.ServerURL); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := h.Get(creds.ServerURL); !credentials.IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected not found after delete, got %v", err)
+	}
+	if err := h.Delete(creds.ServerURL); !credentials.IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected not found deleting a missing entry, got %v", err)
+	}
+}
+
+func TestExecHelperFailure(t *testing.T) {
+	h, _ := newVaultHelper(t)
+	h.GetCommand.Args = []string{"vault", "show"}
+
+	_, _, err := h.Get("https://registry.example.com")
+	if err == nil || err.Error() != "vault: exit status 2: usage: vault show <key>" {
+		t.Fatalf("expected the command failure, got %v", err)
+	}
+}
+
+func TestExecHelperNotFoundExitCode(t *testing.T) {
+	h, _ := newVaultHelper(t)
+	h.NotFoundOutput = ""
+	h.NotFoundExitCodes = []int{1}
+
+	if _, _, err := h.Get("https://registry.example.com"); !credentials.IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestExecHelperPlaceholderInjection(t *testing.T) {
+	h, v := newVaultHelper(t)
+
+	cases := []struct {
+		creds *credentials.Credentials
+		err   string
+	}{
+		{&credentials.Credentials{ServerURL: "--all", Username: "foo", Secret: "bar"}, `exechelper: argument "{url}" would be expanded into an option`},
+		{&credentials.Credentials{ServerURL: "https://registry.example.com", Username: "foo\nbaz", Secret: "bar"}, "exechelper: username contains control characters"},
+		{&credentials.Credentials{ServerURL: "https://registry.example.com", Username: "foo", Secret: "bar\x00"}, "exechelper: secret contains control characters"},
+		{&credentials.Credentials{ServerURL: "https://registry.example.com/../../etc/passwd", Username: "foo", Secret: "bar"}, "exechelper: server URL contains a .. path segment"},
+		{&credentials.Credentials{ServerURL: "https://registry.example.com", Username: "..\\admin", Secret: "bar"}, "exechelper: username contains a .. path segment"},
+	}
+	for _, c := range cases {
+		if err := h.Add(c.creds); err == nil || err.Error() != c.err {
+			t.Fatalf("expected %q for %+v, got %v", c.err, c.creds, err)
+		}
+	}
+	if len(v.calls) != 0 {
+		t.Fatalf("expected no command to run, got %v", v.calls)
+	}
+
+	// Placeholders found in values are not expanded again.
+	if err := h.Add(&credentials.Credentials{ServerURL: "https://{secret}.example.com", Username: "{secret}", Secret: "bar"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := v.calls[0][2]; got != "https://{secret}.example.com" {
+		t.Fatalf("expected the server URL to be kept verbatim, got %q", got)
+	}
+	if got := v.stdins[0]; got != "{secret}\nbar" {
+		t.Fatalf("expected the username to be kept verbatim, got %q", got)
+	}
+}
+
+func TestExecHelperHost(t *testing.T) {
+	h, v := newVaultHelper(t)
+	for _, cmd := range []*Command{&h.GetCommand, &h.AddCommand, &h.DeleteCommand} {
+		cmd.Args[2] = "docker/{host}"
+	}
+
+	if err := h.Add(&credentials.Credentials{ServerURL: "https://registry.example.com:5000/v2/", Username: "foo", Secret: "bar"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := v.calls[0][2]; got != "docker/registry.example.com:5000" {
+		t.Fatalf("expected the entry to be named after the host, got %q", got)
+	}
+	username, _, err := h.Get("registry.example.com:5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if username != "foo" {
+		t.Fatalf("expected the credentials stored for the host, got %s", username)
+	}
+
+	if err := h.Delete("https://registry.example.com/.."); err == nil || err.Error() != "exechelper: server URL contains a .. path segment" {
+		t.Fatalf("expected a .. path segment error, got %v", err)
+	}
+}
+
+func TestExecHelperFormats(t *testing.T) {
+	cases := []struct {
+		cmd      Command
+		out      string
+		username string
+		secret   string
+	}{
+		{Command{Format: FormatLines}, "foo\nbar\n", "foo", "bar"},
+		{Command{}, "foo\r\nbar\r\n", "foo", "bar"},
+		{Command{Format: FormatFields}, "bar\nURL: https://registry.example.com\nUsername: foo\n", "foo", "bar"},
+		{Command{Format: FormatJSON}, `{"Username": "foo", "Secret": "bar"}`, "foo", "bar"},
+		{Command{Format: FormatJSON, UsernameKey: "login", SecretKey: "password"}, `{"login": "foo", "password": "bar", "id": 1}`, "foo", "bar"},
+	}
+	for _, c := range cases {
+		username, secret, err := parseGet(c.cmd, []byte(c.out))
+		if err != nil {
+			t.Fatalf("%q: %v", c.out, err)
+		}
+		if username != c.username || secret != c.secret {
+			t.Fatalf("%q: expected %s/%s, got %s/%s", c.out, c.username, c.secret, username, secret)
+		}
+	}
+
+	list, err := parseList(Command{Format: FormatJSON}, []byte(`{"https://registry.example.com": "foo"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list["https://registry.example.com"] != "foo" {
+		t.Fatalf("expected one entry, got %v", list)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	cases := []struct {
+		config string
+		err    string
+	}{
+		{`{}`, "exechelper: invalid configuration: no command configured"},
+		{`{"get": {"args": ["{url}"]}}`, "exechelper: invalid configuration: get program cannot contain placeholders"},
+		{`{"list": {"args": ["vault", "ls"], "format": "fields"}}`, `exechelper: invalid configuration: unsupported list format "fields"`},
+		{`{"add": {"stdin": "{secret}"}}`, "exechelper: invalid configuration: add command has no args"},
+		{`{"get": {"args": ["vault"]}, "erase": {}}`, `exechelper: invalid configuration: json: unknown field "erase"`},
+	}
+	for _, c := range cases {
+		if _, err := Load(strings.NewReader(c.config)); err == nil || err.Error() != c.err {
+			t.Fatalf("expected %q for %s, got %v", c.err, c.config, err)
+		}
+	}
+}
+
+func TestExecHelperUnconfiguredCommand(t *testing.T) {
+	h, err := Load(strings.NewReader(`{"get": {"args": ["vault", "show", "{url}"]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Delete("https://registry.example.com"); err == nil || err.Error() != "exechelper: no delete command configured" {
+		t.Fatalf("expected an unconfigured command error, got %v", err)
+	}
+}
+
+func TestExecHelperConfigEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exechelper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(path, []byte(vaultConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Setenv(ConfigEnv, os.Getenv(ConfigEnv))
+	os.Setenv(ConfigEnv, path)
+
+	v := newFakeVault()
+	v.entries["https://registry.example.com"] = [2]string{"foo", "bar"}
+	username, secret, err := ExecHelper{Runner: v}.Get("https://registry.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if username != "foo" || secret != "bar" {
+		t.Fatalf("expected foo/bar, got %s/%s", username, secret)
+	}
+}
+
+// TestHelperProcess is not a real test. It is run as a child process by
+// TestProcessRunner and prints its arguments and standard input.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	in, _ := ioutil.ReadAll(os.Stdin)
+	args := os.Args
+	for i, arg := range args {
+		if arg == "--" {
+			args = args[i+1:]
+			break
+		}
+	}
+	if len(args) > 0 && args[0] == "missing" {
+		fmt.Fprint(os.Stderr, "entry not found")
+		os.Exit(3)
+	}
+	fmt.Printf("%s\n%s\n", strings.Join(args, " "), in)
+	os.Exit(0)
+}
+
+func TestProcessRunner(t *testing.T) {
+	defer os.Setenv("GO_WANT_HELPER_PROCESS", os.Getenv("GO_WANT_HELPER_PROCESS"))
+	os.Setenv("GO_WANT_HELPER_PROCESS", "1")
+
+	h := ExecHelper{
+		GetCommand:        Command{Args: []string{os.Args[0], "-test.run=TestHelperProcess", "--", "{url}"}, Stdin: "token"},
+		NotFoundExitCodes: []int{3},
+	}
+	username, secret, err := h.Get("https://registry.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if username != "https://registry.example.com" || secret != "token" {
+		t.Fatalf("expected the argument and stdin back, got %s/%s", username, secret)
+	}
+
+	if _, _, err := h.Get("missing"); !credentials.IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+// Package exectest provides a Runner injecting faults into the commands of
+// an exechelper.ExecHelper, for tests of how helpers handle failing,
+// erroring and slow password manager CLIs.
+package exectest
+
+import (
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/docker/docker-credential-helpers/exechelper"
+)
+
+// Fault describes how a call misbehaves. A call with a non-zero ExitCode or
+// a non-empty Stderr fails with that result, exiting with 1 by default,
+// instead of reaching the wrapped runner, and a call with an Err fails to
+// run at all. Delay is waited before the call, or until the
+// credentials.OperationContext is canceled.
+type Fault struct {
+	Err      error
+	ExitCode int
+	Stderr   string
+	Delay    time.Duration
+}
+
+// FaultyRunner wraps a Runner, injecting scripted faults into its calls.
+type FaultyRunner struct {
+	// Runner runs the calls without a fault, or those only delayed.
+	Runner exechelper.Runner
+
+	mu     sync.Mutex
+	calls  int
+	nth    map[int]Fault
+	always *Fault
+}
+
+// New returns a FaultyRunner wrapping runner.
+func New(runner exechelper.Runner) *FaultyRunner {
+	return &FaultyRunner{Runner: runner, nth: map[int]Fault{}}
+}
+
+// FailCall injects a fault into the nth call, counting from 1.
+func (r *FaultyRunner) FailCall(n int, fault Fault) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nth[n] = fault
+}
+
+// FailAll injects a fault into every call without a fault of its own.
+func (r *FaultyRunner) FailAll(fault Fault) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.always = &fault
+}
+
+// Calls returns the number of calls made so far.
+func (r *FaultyRunner) Calls() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls
+}
+
+// Run runs a call, applying its fault.
+func (r *FaultyRunner) Run(name string, args []string, stdin io.Reader) (exechelper.Result, error) {
+	r.mu.Lock()
+	r.calls++
+	fault, ok := r.nth[r.calls]
+	if !ok && r.always != nil {
+		fault, ok = *r.always, true
+	}
+	r.mu.Unlock()
+	if !ok {
+		return r.Runner.Run(name, args, stdin)
+	}
+
+	if fault.Delay > 0 {
+		ctx := credentials.OperationContext()
+		timer := time.NewTimer(fault.Delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return exechelper.Result{}, ctx.Err()
+		}
+	}
+	if fault.Err != nil {
+		return exechelper.Result{}, fault.Err
+	}
+	if fault.ExitCode != 0 || fault.Stderr != "" {
+		// Consume the input like a real program would.
+		ioutil.ReadAll(stdin)
+		code := fault.ExitCode
+		if code == 0 {
+			code = 1
+		}
+		return exechelper.Result{Stderr: []byte(fault.Stderr), ExitCode: code}, nil
+	}
+	return r.Runner.Run(name, args, stdin)
+}
@@ -0,0 +1,68 @@
+package exechelper_test
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/docker/docker-credential-helpers/exechelper"
+	"github.com/docker/docker-credential-helpers/exechelper/exectest"
+)
+
+// echoRunner prints the credentials foo/bar for any command.
+type echoRunner struct{}
+
+func (echoRunner) Run(name string, args []string, stdin io.Reader) (exechelper.Result, error) {
+	return exechelper.Result{Stdout: []byte("foo\nbar\n")}, nil
+}
+
+func newFaultyHelper() (*exechelper.ExecHelper, *exectest.FaultyRunner) {
+	runner := exectest.New(echoRunner{})
+	h := &exechelper.ExecHelper{
+		GetCommand:        exechelper.Command{Args: []string{"vault", "show", "{url}"}},
+		NotFoundExitCodes: []int{4},
+		Runner:            runner,
+	}
+	return h, runner
+}
+
+func TestFaultyRunnerNthCall(t *testing.T) {
+	h, runner := newFaultyHelper()
+	runner.FailCall(2, exectest.Fault{ExitCode: 2, Stderr: "vault: sealed\n"})
+	runner.FailCall(3, exectest.Fault{ExitCode: 4})
+	runner.FailCall(4, exectest.Fault{Err: errors.New("executable file not found in $PATH")})
+
+	if _, secret, err := h.Get("https://registry.example.com"); err != nil || secret != "bar" {
+		t.Fatalf("expected the first call to succeed, got %q, %v", secret, err)
+	}
+	if _, _, err := h.Get("https://registry.example.com"); err == nil || err.Error() != "vault: exit status 2: vault: sealed" {
+		t.Fatalf("expected the injected failure, got %v", err)
+	}
+	if _, _, err := h.Get("https://registry.example.com"); !credentials.IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected the injected exit code to map to not found, got %v", err)
+	}
+	if _, _, err := h.Get("https://registry.example.com"); err == nil || err.Error() != "vault: executable file not found in $PATH" {
+		t.Fatalf("expected the injected run error, got %v", err)
+	}
+	if _, _, err := h.Get("https://registry.example.com"); err != nil {
+		t.Fatalf("expected the fifth call to succeed, got %v", err)
+	}
+	if runner.Calls() != 5 {
+		t.Fatalf("expected 5 calls, got %d", runner.Calls())
+	}
+}
+
+func TestFaultyRunnerDelay(t *testing.T) {
+	h, runner := newFaultyHelper()
+	runner.FailAll(exectest.Fault{Delay: 50 * time.Millisecond})
+
+	start := time.Now()
+	if _, secret, err := h.Get("https://registry.example.com"); err != nil || secret != "bar" {
+		t.Fatalf("expected the delayed call to succeed, got %q, %v", secret, err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("expected the call to be delayed, took %v", elapsed)
+	}
+}
@@ -0,0 +1,46 @@
+package exechelper
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	exec "golang.org/x/sys/execabs"
+)
+
+// Result holds the outcome of a command which ran to completion.
+type Result struct {
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+}
+
+// Runner runs the commands of an ExecHelper.
+type Runner interface {
+	// Run runs a program with the given arguments and standard input. A
+	// non-zero exit code is reported in the result; the error is reserved
+	// for programs which could not be run.
+	Run(name string, args []string, stdin io.Reader) (Result, error)
+}
+
+// ProcessRunner runs commands as child processes.
+type ProcessRunner struct{}
+
+// Run runs the program as a child process, looking it up in PATH. The
+// process is killed when the credentials.OperationContext is canceled.
+func (ProcessRunner) Run(name string, args []string, stdin io.Reader) (Result, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(credentials.OperationContext(), name, args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return Result{Stdout: stdout.Bytes(), Stderr: stderr.Bytes(), ExitCode: exitErr.ExitCode()}, nil
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Stdout: stdout.Bytes(), Stderr: stderr.Bytes()}, nil
+}
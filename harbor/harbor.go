@@ -0,0 +1,539 @@
+// A Harbor based credential helper, which manages the robot accounts of a
+// Harbor project as the registry credentials of the Harbor host. Each robot
+// account managed by the helper records the server URL of its credentials in
+// its description, prefixed with the credentials label.
+//
+// Harbor never returns the secret of an existing robot account, so the
+// secret set by Add is kept in the Secrets helper, and Get reads it back from
+// there. Without a Secrets helper, Get reports the credentials as not found:
+// the robot accounts can only be stored to.
+package harbor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/docker/docker-credential-helpers/registryurl"
+)
+
+// Environment variables used to configure the helper when the matching
+// Harbor fields are left empty.
+const (
+	EnvURL      = "HARBOR_URL"
+	EnvUsername = "HARBOR_USERNAME"
+	EnvPassword = "HARBOR_PASSWORD"
+	EnvProject  = "HARBOR_PROJECT"
+	// EnvSecretsStore names the registered backend keeping the secrets of
+	// the robot accounts, when the Secrets helper is nil.
+	EnvSecretsStore = "HARBOR_SECRETS_STORE"
+	// EnvTimeout is the timeout of requests to the server, as a duration
+	// such as "10s". It defaults to DefaultTimeout.
+	EnvTimeout = "HARBOR_TIMEOUT"
+)
+
+// DefaultTimeout is the timeout of requests to the server when EnvTimeout is
+// not set.
+const DefaultTimeout = 30 * time.Second
+
+// robotNamePattern matches the characters Harbor accepts in robot names.
+var robotNamePattern = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// Harbor handles secrets using the robot accounts of a Harbor project.
+// Empty fields fall back to the HARBOR_* environment variables, so the zero
+// value is ready to use from a credential helper binary.
+type Harbor struct {
+	// URL is the base URL of the Harbor server.
+	URL string
+	// Username and Password are the credentials of a Harbor user allowed
+	// to manage the robot accounts of the project.
+	Username string
+	Password string
+	// Project is the name of the project owning the robot accounts.
+	Project string
+	// Client is the HTTP client used to reach the server.
+	Client *http.Client
+	// Secrets keeps the secrets of the robot accounts, by the server URL
+	// recorded in their description.
+	Secrets credentials.Helper
+}
+
+type access struct {
+	Resource string `json:"resource"`
+	Action   string `json:"action"`
+}
+
+type permission struct {
+	Kind      string   `json:"kind"`
+	Namespace string   `json:"namespace"`
+	Access    []access `json:"access"`
+}
+
+type robot struct {
+	ID          int64        `json:"id,omitempty"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Secret      string       `json:"secret,omitempty"`
+	Level       string       `json:"level"`
+	Duration    int64        `json:"duration"`
+	Permissions []permission `json:"permissions,omitempty"`
+}
+
+type robotSecret struct {
+	Secret string `json:"secret,omitempty"`
+}
+
+type project struct {
+	ID   int64  `json:"project_id"`
+	Name string `json:"name"`
+}
+
+type errorEntry struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// apiError is the error document returned by the Harbor server.
+type apiError struct {
+	Status int          `json:"-"`
+	Errors []errorEntry `json:"errors"`
+}
+
+func (e *apiError) Error() string {
+	var messages []string
+	for _, err := range e.Errors {
+		messages = append(messages, err.Message)
+	}
+	return fmt.Sprintf("harbor: %d: %s", e.Status, strings.Join(messages, "; "))
+}
+
+func isNotFound(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound
+}
+
+func (h Harbor) url() string {
+	if h.URL != "" {
+		return h.URL
+	}
+	return os.Getenv(EnvURL)
+}
+
+func (h Harbor) username() string {
+	if h.Username != "" {
+		return h.Username
+	}
+	return os.Getenv(EnvUsername)
+}
+
+func (h Harbor) password() string {
+	if h.Password != "" {
+		return h.Password
+	}
+	return os.Getenv(EnvPassword)
+}
+
+func (h Harbor) project() string {
+	if h.Project != "" {
+		return h.Project
+	}
+	return os.Getenv(EnvProject)
+}
+
+// secrets returns the helper keeping the secrets of the robot accounts, or
+// nil if there is none.
+func (h Harbor) secrets() (credentials.Helper, error) {
+	if h.Secrets != nil {
+		return h.Secrets, nil
+	}
+	name := os.Getenv(EnvSecretsStore)
+	if name == "" {
+		return nil, nil
+	}
+	store, err := credentials.NewBackend(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := store.(Harbor); ok {
+		return nil, fmt.Errorf("harbor: %s must name the backend keeping the secrets", EnvSecretsStore)
+	}
+	return store, nil
+}
+
+// saveSecret keeps the secret of a robot account in the Secrets helper, if
+// any.
+func (h Harbor) saveSecret(r robot, secret string) error {
+	secrets, err := h.secrets()
+	if err != nil || secrets == nil {
+		return err
+	}
+	serverURL, _ := r.serverURL()
+	return secrets.Add(&credentials.Credentials{ServerURL: serverURL, Username: r.Name, Secret: secret})
+}
+
+// clientMutex is held while creating sharedClient, the HTTP client used by
+// all Harbor values without a Client of their own.
+var clientMutex sync.Mutex
+var sharedClient *http.Client
+
+// newHTTPClient creates the shared HTTP client.
+var newHTTPClient = func() (*http.Client, error) {
+	timeout := DefaultTimeout
+	if v := os.Getenv(EnvTimeout); v != "" {
+		var err error
+		if timeout, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("harbor: invalid %s: %v", EnvTimeout, err)
+		}
+	}
+	return &http.Client{Timeout: timeout}, nil
+}
+
+func (h Harbor) client() (*http.Client, error) {
+	if h.Client != nil {
+		return h.Client, nil
+	}
+
+	clientMutex.Lock()
+	defer clientMutex.Unlock()
+	if sharedClient == nil {
+		client, err := newHTTPClient()
+		if err != nil {
+			return nil, err
+		}
+		sharedClient = client
+	}
+	return sharedClient, nil
+}
+
+// do sends a request to the Harbor API and decodes the JSON response into
+// out, if out is not nil.
+func (h Harbor) do(method, path string, body, out interface{}) error {
+	base, username := h.url(), h.username()
+	if base == "" {
+		return fmt.Errorf("harbor: %s is not set", EnvURL)
+	}
+	if username == "" {
+		return fmt.Errorf("harbor: %s is not set", EnvUsername)
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(credentials.OperationContext(), method, strings.TrimRight(base, "/")+"/api/v2.0"+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(username, h.password())
+	req.Header.Set("X-Is-Resource-Name", "true")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client, err := h.client()
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return credentials.ClassifyTransportError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &apiError{}
+		b, _ := ioutil.ReadAll(resp.Body)
+		if json.Unmarshal(b, apiErr) != nil || len(apiErr.Errors) == 0 {
+			apiErr.Errors = []errorEntry{{Message: strings.TrimSpace(string(b))}}
+		}
+		apiErr.Status = resp.StatusCode
+		return credentials.ClassifyHTTPStatus(resp.StatusCode, apiErr)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// projectID returns the ID of the configured project.
+func (h Harbor) projectID() (int64, error) {
+	name := h.project()
+	if name == "" {
+		return 0, fmt.Errorf("harbor: %s is not set", EnvProject)
+	}
+	var p project
+	if err := h.do(http.MethodGet, "/projects/"+url.PathEscape(name), nil, &p); err != nil {
+		if isNotFound(err) {
+			return 0, fmt.Errorf("harbor: project %q not found", name)
+		}
+		return 0, err
+	}
+	return p.ID, nil
+}
+
+// description returns the description of the robot account holding the
+// credentials of a server URL.
+func description(serverURL string) string {
+	return credentials.CredsLabel + ": " + serverURL
+}
+
+// serverURL returns the server URL recorded in the description of a robot
+// account, and whether the helper manages it.
+func (r robot) serverURL() (string, bool) {
+	prefix := credentials.CredsLabel + ": "
+	if !strings.HasPrefix(r.Description, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(r.Description, prefix), true
+}
+
+// robotName derives the name of a new robot account from the username of
+// the credentials, which may be the full name of a Harbor robot account.
+func robotName(username, host string) string {
+	name := username
+	if i := strings.LastIndex(name, "+"); strings.HasPrefix(name, "robot$") && i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Trim(robotNamePattern.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if name == "" {
+		name = strings.Trim(robotNamePattern.ReplaceAllString(strings.ToLower(host), "-"), "-")
+	}
+	return name
+}
+
+func registryHost(serverURL string) (string, error) {
+	u, err := registryurl.Parse(serverURL)
+	if err != nil {
+		return "", err
+	}
+	return u.Host, nil
+}
+
+// robots returns the robot accounts of the project managed by the helper.
+func (h Harbor) robots(projectID int64) ([]robot, error) {
+	var managed []robot
+	for page := 1; ; page++ {
+		var robots []robot
+		q := url.QueryEscape(fmt.Sprintf("Level=project,ProjectID=%d", projectID))
+		if err := h.do(http.MethodGet, fmt.Sprintf("/robots?q=%s&page=%d&page_size=100", q, page), nil, &robots); err != nil {
+			return nil, err
+		}
+		for _, r := range robots {
+			if _, ok := r.serverURL(); ok {
+				managed = append(managed, r)
+			}
+		}
+		if len(robots) < 100 {
+			return managed, nil
+		}
+	}
+}
+
+// findRobot returns the managed robot account holding the credentials of the
+// registry host of a server URL, or nil if there is none.
+func (h Harbor) findRobot(projectID int64, serverURL string) (*robot, error) {
+	host, err := registryHost(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	robots, err := h.robots(projectID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range robots {
+		u, _ := robots[i].serverURL()
+		if robotHost, err := registryHost(u); err == nil && robotHost == host {
+			return &robots[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// refreshSecret sets the secret of a robot account, or generates a new one
+// if secret is empty, and returns it.
+func (h Harbor) refreshSecret(id int64, secret string) (string, error) {
+	var resp robotSecret
+	if err := h.do(http.MethodPatch, fmt.Sprintf("/robots/%d", id), robotSecret{Secret: secret}, &resp); err != nil {
+		return "", err
+	}
+	return resp.Secret, nil
+}
+
+// Add creates a robot account allowed to pull and push the repositories of
+// the project, named after the username of the credentials. It sets the
+// secret of the robot account to the secret of the credentials, or lets
+// Harbor generate one, and keeps it in the Secrets helper. When a robot
+// account already holds the credentials of the registry host, only its
+// secret is updated.
+func (h Harbor) Add(creds *credentials.Credentials) error {
+	if creds == nil {
+		return errors.New("missing credentials")
+	}
+
+	host, err := registryHost(creds.ServerURL)
+	if err != nil {
+		return err
+	}
+	projectID, err := h.projectID()
+	if err != nil {
+		return err
+	}
+	existing, err := h.findRobot(projectID, creds.ServerURL)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		secret, err := h.refreshSecret(existing.ID, creds.Secret)
+		if err != nil {
+			return err
+		}
+		if secret == "" {
+			secret = creds.Secret
+		}
+		return h.saveSecret(*existing, secret)
+	}
+
+	r := robot{
+		Name:        robotName(creds.Username, host),
+		Description: description(creds.ServerURL),
+		Level:       "project",
+		Duration:    -1,
+		Permissions: []permission{{
+			Kind:      "project",
+			Namespace: h.project(),
+			Access: []access{
+				{Resource: "repository", Action: "pull"},
+				{Resource: "repository", Action: "push"},
+			},
+		}},
+	}
+	var created robot
+	if err := h.do(http.MethodPost, "/robots", r, &created); err != nil {
+		return err
+	}
+	secret := created.Secret
+	if creds.Secret != "" {
+		if _, err := h.refreshSecret(created.ID, creds.Secret); err != nil {
+			return err
+		}
+		secret = creds.Secret
+	}
+	created.Description = r.Description
+	return h.saveSecret(created, secret)
+}
+
+// Delete removes the robot account holding the credentials of a server URL,
+// along with its secret.
+func (h Harbor) Delete(serverURL string) error {
+	if serverURL == "" {
+		return errors.New("missing server url")
+	}
+
+	projectID, err := h.projectID()
+	if err != nil {
+		return err
+	}
+	r, err := h.findRobot(projectID, serverURL)
+	if err != nil {
+		return err
+	}
+	if r == nil {
+		return credentials.NewErrCredentialsNotFound()
+	}
+
+	err = h.do(http.MethodDelete, fmt.Sprintf("/robots/%d", r.ID), nil, nil)
+	if isNotFound(err) {
+		return credentials.NewErrCredentialsNotFound()
+	}
+	if err != nil {
+		return err
+	}
+	secrets, err := h.secrets()
+	if err != nil || secrets == nil {
+		return err
+	}
+	robotURL, _ := r.serverURL()
+	if err := secrets.Delete(robotURL); err != nil && !credentials.IsErrCredentialsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// Get returns the name of the robot account holding the credentials of a
+// server URL, along with the secret kept in the Secrets helper. It never
+// changes the robot account.
+func (h Harbor) Get(serverURL string) (string, string, error) {
+	if serverURL == "" {
+		return "", "", errors.New("missing server url")
+	}
+
+	secrets, err := h.secrets()
+	if err != nil {
+		return "", "", err
+	}
+	if secrets == nil {
+		return "", "", credentials.NewErrCredentialsNotFound()
+	}
+	projectID, err := h.projectID()
+	if err != nil {
+		return "", "", err
+	}
+	r, err := h.findRobot(projectID, serverURL)
+	if err != nil {
+		return "", "", err
+	}
+	if r == nil {
+		return "", "", credentials.NewErrCredentialsNotFound()
+	}
+
+	robotURL, _ := r.serverURL()
+	_, secret, err := secrets.Get(robotURL)
+	if err != nil {
+		return "", "", err
+	}
+	return r.Name, secret, nil
+}
+
+// List returns the server URLs and the names of the robot accounts managed
+// by the helper.
+func (h Harbor) List() (map[string]string, error) {
+	projectID, err := h.projectID()
+	if err != nil {
+		return nil, err
+	}
+	robots, err := h.robots(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := map[string]string{}
+	for _, r := range robots {
+		serverURL, _ := r.serverURL()
+		resp[serverURL] = r.Name
+	}
+	return resp, nil
+}
+
+// Check looks up the configured project, which checks that the server is
+// reachable and accepts the configured account.
+func (h Harbor) Check() error {
+	_, err := h.projectID()
+	return err
+}
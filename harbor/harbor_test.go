@@ -0,0 +1,335 @@
+package harbor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+)
+
+// fakeHarbor is an in-memory stand-in for the robot accounts API of a Harbor
+// server with a single project, "library".
+type fakeHarbor struct {
+	mu      sync.Mutex
+	robots  map[int64]robot
+	nextID  int64
+	secrets int
+	patches int
+}
+
+func newFakeHarbor() *fakeHarbor {
+	return &fakeHarbor{robots: map[int64]robot{}}
+}
+
+func (f *fakeHarbor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if username, password, ok := r.BasicAuth(); !ok || username != "admin" || password != "Harbor12345" {
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "unauthorized")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/v2.0")
+	switch {
+	case strings.HasPrefix(path, "/projects/"):
+		if strings.TrimPrefix(path, "/projects/") != "library" {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "project not found")
+			return
+		}
+		json.NewEncoder(w).Encode(project{ID: 1, Name: "library"})
+	case path == "/robots" && r.Method == http.MethodGet:
+		if r.URL.Query().Get("q") != "Level=project,ProjectID=1" {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "unexpected query")
+			return
+		}
+		robots := []robot{}
+		for _, rb := range f.robots {
+			rb.Secret = ""
+			robots = append(robots, rb)
+		}
+		json.NewEncoder(w).Encode(robots)
+	case path == "/robots" && r.Method == http.MethodPost:
+		var rb robot
+		json.NewDecoder(r.Body).Decode(&rb)
+		if len(rb.Permissions) != 1 || rb.Permissions[0].Namespace != "library" {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "invalid permissions")
+			return
+		}
+		f.nextID++
+		rb.ID = f.nextID
+		rb.Name = "robot$library+" + rb.Name
+		rb.Secret = f.generate()
+		f.robots[rb.ID] = rb
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(rb)
+	case strings.HasPrefix(path, "/robots/"):
+		id, _ := strconv.ParseInt(strings.TrimPrefix(path, "/robots/"), 10, 64)
+		rb, ok := f.robots[id]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "robot not found")
+			return
+		}
+		switch r.Method {
+		case http.MethodPatch:
+			f.patches++
+			var sec robotSecret
+			json.NewDecoder(r.Body).Decode(&sec)
+			if sec.Secret == "" {
+				sec.Secret = f.generate()
+			}
+			rb.Secret = sec.Secret
+			f.robots[id] = rb
+			json.NewEncoder(w).Encode(sec)
+		case http.MethodDelete:
+			delete(f.robots, id)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "method not allowed")
+		}
+	default:
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "not found")
+	}
+}
+
+func (f *fakeHarbor) generate() string {
+	f.secrets++
+	return fmt.Sprintf("generated%d", f.secrets)
+}
+
+// secretStore is an in-memory Secrets helper.
+type secretStore map[string]credentials.Credentials
+
+func (s secretStore) Add(creds *credentials.Credentials) error {
+	s[creds.ServerURL] = *creds
+	return nil
+}
+
+func (s secretStore) Delete(serverURL string) error {
+	if _, ok := s[serverURL]; !ok {
+		return credentials.NewErrCredentialsNotFound()
+	}
+	delete(s, serverURL)
+	return nil
+}
+
+func (s secretStore) Get(serverURL string) (string, string, error) {
+	c, ok := s[serverURL]
+	if !ok {
+		return "", "", credentials.NewErrCredentialsNotFound()
+	}
+	return c.Username, c.Secret, nil
+}
+
+func (s secretStore) List() (map[string]string, error) {
+	accts := map[string]string{}
+	for serverURL, c := range s {
+		accts[serverURL] = c.Username
+	}
+	return accts, nil
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiError{Errors: []errorEntry{{Code: code, Message: message}}})
+}
+
+func TestHarborHelper(t *testing.T) {
+	fake := newFakeHarbor()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	helper := Harbor{URL: server.URL, Username: "admin", Password: "Harbor12345", Project: "library", Secrets: secretStore{}}
+
+	creds := &credentials.Credentials{
+		ServerURL: "https://harbor.example.com",
+		Username:  "CI Builds",
+		Secret:    "Passw0rdOfCI",
+	}
+	if err := helper.Add(creds); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.robots) != 1 {
+		t.Fatalf("expected one robot account, got %v", fake.robots)
+	}
+	rb := fake.robots[1]
+	if rb.Name != "robot$library+ci-builds" || rb.Secret != "Passw0rdOfCI" {
+		t.Fatalf("unexpected robot account %+v", rb)
+	}
+
+	// Adding credentials again for the same host updates the secret.
+	creds.Secret = "Upd4tedSecret"
+	if err := helper.Add(creds); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.robots) != 1 || fake.robots[1].Secret != "Upd4tedSecret" {
+		t.Fatalf("expected the secret to be updated, got %v", fake.robots)
+	}
+
+	username, secret, err := helper.Get("harbor.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if username != "robot$library+ci-builds" {
+		t.Fatalf("expected the robot name, got %s", username)
+	}
+	if secret != "Upd4tedSecret" {
+		t.Fatalf("expected the stored secret, got %s", secret)
+	}
+
+	// Getting the credentials again returns the same secret, without
+	// changing the robot account.
+	patches := fake.patches
+	if _, again, err := helper.Get("harbor.example.com"); err != nil || again != secret {
+		t.Fatalf("expected the same secret, got %s, %v", again, err)
+	}
+	if fake.patches != patches || fake.robots[1].Secret != "Upd4tedSecret" {
+		t.Fatalf("expected get not to refresh the secret, got %d refreshes", fake.patches-patches)
+	}
+
+	credsList, err := helper.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(credsList) != 1 || credsList[creds.ServerURL] != "robot$library+ci-builds" {
+		t.Fatalf("unexpected list result: %v", credsList)
+	}
+
+	if err := helper.Delete(creds.ServerURL); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.robots) != 0 {
+		t.Fatalf("expected the robot account to be deleted, got %v", fake.robots)
+	}
+	if len(helper.Secrets.(secretStore)) != 0 {
+		t.Fatalf("expected the secret to be deleted, got %v", helper.Secrets)
+	}
+	if _, _, err := helper.Get(creds.ServerURL); !credentials.IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+	if err := helper.Delete(creds.ServerURL); !credentials.IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestHarborHelperGeneratedSecret(t *testing.T) {
+	fake := newFakeHarbor()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	helper := Harbor{URL: server.URL, Username: "admin", Password: "Harbor12345", Project: "library", Secrets: secretStore{}}
+	if err := helper.Add(&credentials.Credentials{ServerURL: "harbor.example.com", Username: "ci"}); err != nil {
+		t.Fatal(err)
+	}
+	_, secret, err := helper.Get("harbor.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret != fake.robots[1].Secret {
+		t.Fatalf("expected the generated secret, got %s", secret)
+	}
+}
+
+func TestHarborHelperWithoutSecrets(t *testing.T) {
+	fake := newFakeHarbor()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	helper := Harbor{URL: server.URL, Username: "admin", Password: "Harbor12345", Project: "library"}
+	if err := helper.Add(&credentials.Credentials{ServerURL: "harbor.example.com", Username: "ci", Secret: "s3cret"}); err != nil {
+		t.Fatal(err)
+	}
+	patches := fake.patches
+	if _, _, err := helper.Get("harbor.example.com"); !credentials.IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected not found without a secrets store, got %v", err)
+	}
+	if fake.patches != patches {
+		t.Fatal("expected get not to refresh the secret")
+	}
+}
+
+func TestHarborHelperUnmanagedRobots(t *testing.T) {
+	fake := newFakeHarbor()
+	fake.robots[7] = robot{ID: 7, Name: "robot$library+deploy", Description: "deployments", Level: "project"}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	helper := Harbor{URL: server.URL, Username: "admin", Password: "Harbor12345", Project: "library", Secrets: secretStore{}}
+
+	credsList, err := helper.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(credsList) != 0 {
+		t.Fatalf("expected robot accounts not managed by the helper to be ignored, got %v", credsList)
+	}
+	if _, _, err := helper.Get("https://harbor.example.com"); !credentials.IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+	if fake.robots[7].Secret != "" {
+		t.Fatal("expected the secret of an unmanaged robot account to be left untouched")
+	}
+}
+
+func TestHarborHelperErrors(t *testing.T) {
+	server := httptest.NewServer(newFakeHarbor())
+	defer server.Close()
+
+	helper := Harbor{URL: server.URL, Username: "admin", Password: "wrong", Project: "library", Secrets: secretStore{}}
+	_, _, err := helper.Get("https://harbor.example.com")
+	if err == nil || err.Error() != "harbor: 401: unauthorized" {
+		t.Fatalf("expected an unauthorized error, got %v", err)
+	}
+	if !errors.Is(err, credentials.ErrPermissionDenied) {
+		t.Fatalf("expected a permission denied error, got %v", err)
+	}
+
+	helper = Harbor{URL: server.URL, Username: "admin", Password: "Harbor12345", Project: "missing"}
+	if _, err := helper.List(); err == nil || err.Error() != `harbor: project "missing" not found` {
+		t.Fatalf("expected a project not found error, got %v", err)
+	}
+
+	helper = Harbor{URL: server.URL, Username: "admin", Password: "Harbor12345"}
+	if _, err := helper.List(); err == nil || err.Error() != "harbor: HARBOR_PROJECT is not set" {
+		t.Fatalf("expected a missing configuration error, got %v", err)
+	}
+}
+
+func TestHarborHelperCheck(t *testing.T) {
+	server := httptest.NewServer(newFakeHarbor())
+	defer server.Close()
+
+	helper := Harbor{URL: server.URL, Username: "admin", Password: "Harbor12345", Project: "library", Secrets: secretStore{}}
+	if err := credentials.Check(helper); err != nil {
+		t.Fatal(err)
+	}
+
+	helper.Password = "wrong"
+	if err := credentials.Check(helper); !errors.Is(err, credentials.ErrPermissionDenied) {
+		t.Fatalf("expected a permission denied error, got %v", err)
+	}
+}
+
+func TestRobotName(t *testing.T) {
+	tests := []struct {
+		username string
+		host     string
+		name     string
+	}{
+		{username: "ci", host: "harbor.example.com", name: "ci"},
+		{username: "robot$library+ci", host: "harbor.example.com", name: "ci"},
+		{username: "CI Builds!", host: "harbor.example.com", name: "ci-builds"},
+		{username: "", host: "harbor.example.com:8443", name: "harbor.example.com-8443"},
+	}
+	for _, te := range tests {
+		if name := robotName(te.username, te.host); name != te.name {
+			t.Errorf("expected %s for %q, got %s", te.name, te.username, name)
+		}
+	}
+}
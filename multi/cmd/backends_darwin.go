@@ -0,0 +1,12 @@
+package main
+
+import (
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/docker/docker-credential-helpers/osxkeychain"
+)
+
+func init() {
+	credentials.Register("osxkeychain", func() (credentials.Helper, error) {
+		return osxkeychain.Osxkeychain{}, nil
+	})
+}
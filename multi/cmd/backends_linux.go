@@ -0,0 +1,16 @@
+package main
+
+import (
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/docker/docker-credential-helpers/pass"
+	"github.com/docker/docker-credential-helpers/secretservice"
+)
+
+func init() {
+	credentials.Register("pass", func() (credentials.Helper, error) {
+		return pass.Pass{}, nil
+	})
+	credentials.Register("secretservice", func() (credentials.Helper, error) {
+		return secretservice.Secretservice{}, nil
+	})
+}
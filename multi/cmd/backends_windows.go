@@ -0,0 +1,12 @@
+package main
+
+import (
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/docker/docker-credential-helpers/wincred"
+)
+
+func init() {
+	credentials.Register("wincred", func() (credentials.Helper, error) {
+		return wincred.Wincred{}, nil
+	})
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/docker/docker-credential-helpers/dockerconfig"
+	"github.com/docker/docker-credential-helpers/ecr"
+	"github.com/docker/docker-credential-helpers/env"
+	"github.com/docker/docker-credential-helpers/exechelper"
+	"github.com/docker/docker-credential-helpers/harbor"
+	"github.com/docker/docker-credential-helpers/ocivault"
+	"github.com/docker/docker-credential-helpers/opconnect"
+)
+
+func init() {
+	credentials.Register("dockerconfig", func() (credentials.Helper, error) {
+		return dockerconfig.ConfigFile{}, nil
+	})
+	credentials.Register("ecr", func() (credentials.Helper, error) {
+		return &ecr.ECR{}, nil
+	})
+	credentials.Register("env", func() (credentials.Helper, error) {
+		return env.Env{}, nil
+	})
+	credentials.Register("exec", func() (credentials.Helper, error) {
+		return exechelper.ExecHelper{}, nil
+	})
+	credentials.Register("harbor", func() (credentials.Helper, error) {
+		return harbor.Harbor{}, nil
+	})
+	credentials.Register("opconnect", func() (credentials.Helper, error) {
+		return opconnect.Connect{}, nil
+	})
+	credentials.Register("ocivault", func() (credentials.Helper, error) {
+		return ocivault.Vault{}, nil
+	})
+}
+
+func main() {
+	credentials.ServeBackend()
+}
@@ -0,0 +1,320 @@
+package ocivault
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment variables selecting the config file profile, following the OCI
+// CLI convention.
+const (
+	EnvConfigFile = "OCI_CLI_CONFIG_FILE"
+	EnvProfile    = "OCI_CLI_PROFILE"
+)
+
+// configProfile signs requests with the API key of an OCI config file profile.
+type configProfile struct {
+	keyID      string
+	key        *rsa.PrivateKey
+	regionName string
+}
+
+func (p *configProfile) signingKey() (string, *rsa.PrivateKey, error) {
+	return p.keyID, p.key, nil
+}
+
+func (p *configProfile) region() (string, error) {
+	return p.regionName, nil
+}
+
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	return path
+}
+
+// parseConfig parses an OCI config file. Values of the DEFAULT profile are
+// inherited by the other profiles.
+func parseConfig(data []byte) map[string]map[string]string {
+	profiles := map[string]map[string]string{}
+	current := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			current = strings.TrimSpace(line[1 : len(line)-1])
+			if profiles[current] == nil {
+				profiles[current] = map[string]string{}
+			}
+			continue
+		}
+		if i := strings.Index(line, "="); i > 0 && current != "" {
+			profiles[current][strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+		}
+	}
+	for name, values := range profiles {
+		if name == "DEFAULT" {
+			continue
+		}
+		for k, v := range profiles["DEFAULT"] {
+			if _, ok := values[k]; !ok {
+				values[k] = v
+			}
+		}
+	}
+	return profiles
+}
+
+func parsePrivateKey(data []byte, passphrase string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("oci: no PEM data in private key")
+	}
+	der := block.Bytes
+	if x509.IsEncryptedPEMBlock(block) {
+		var err error
+		if der, err = x509.DecryptPEMBlock(block, []byte(passphrase)); err != nil {
+			return nil, fmt.Errorf("oci: cannot decrypt private key: %v", err)
+		}
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("oci: cannot parse private key: %v", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("oci: private key is not an RSA key")
+	}
+	return key, nil
+}
+
+// loadConfigProfile loads a profile of an OCI config file, defaulting to the
+// DEFAULT profile of ~/.oci/config.
+func loadConfigProfile(path, profile string) (*configProfile, error) {
+	if path == "" {
+		path = "~/.oci/config"
+	}
+	if profile == "" {
+		profile = "DEFAULT"
+	}
+
+	data, err := ioutil.ReadFile(expandHome(path))
+	if err != nil {
+		return nil, fmt.Errorf("oci: cannot read config file: %v", err)
+	}
+	values, ok := parseConfig(data)[profile]
+	if !ok {
+		return nil, fmt.Errorf("oci: profile %s not found in %s", profile, path)
+	}
+	for _, k := range []string{"tenancy", "user", "fingerprint", "key_file", "region"} {
+		if values[k] == "" {
+			return nil, fmt.Errorf("oci: %s is missing from profile %s", k, profile)
+		}
+	}
+
+	keyData, err := ioutil.ReadFile(expandHome(values["key_file"]))
+	if err != nil {
+		return nil, fmt.Errorf("oci: cannot read private key: %v", err)
+	}
+	key, err := parsePrivateKey(keyData, values["pass_phrase"])
+	if err != nil {
+		return nil, err
+	}
+
+	return &configProfile{
+		keyID:      values["tenancy"] + "/" + values["user"] + "/" + values["fingerprint"],
+		key:        key,
+		regionName: values["region"],
+	}, nil
+}
+
+// instancePrincipal signs requests with a security token obtained by
+// federating the identity certificate of the compute instance. The token is
+// fetched once and reused for the lifetime of the process.
+type instancePrincipal struct {
+	metadataURL string
+	authURL     string
+	httpClient  *http.Client
+
+	once       sync.Once
+	keyID      string
+	key        *rsa.PrivateKey
+	regionName string
+	err        error
+}
+
+func newInstancePrincipal() *instancePrincipal {
+	return &instancePrincipal{
+		metadataURL: "http://169.254.169.254/opc/v2",
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *instancePrincipal) signingKey() (string, *rsa.PrivateKey, error) {
+	p.once.Do(func() { p.err = p.federate() })
+	return p.keyID, p.key, p.err
+}
+
+func (p *instancePrincipal) region() (string, error) {
+	p.once.Do(func() { p.err = p.federate() })
+	return p.regionName, p.err
+}
+
+func (p *instancePrincipal) metadata(path string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, p.metadataURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer Oracle")
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oci: instance metadata: %v", err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oci: instance metadata %s: %s", path, resp.Status)
+	}
+	return bytes.TrimSpace(b), nil
+}
+
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("oci: no PEM data in certificate")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func tenancyOf(cert *x509.Certificate) (string, error) {
+	for _, ou := range cert.Subject.OrganizationalUnit {
+		if strings.HasPrefix(ou, "opc-tenant:") {
+			return strings.TrimPrefix(ou, "opc-tenant:"), nil
+		}
+	}
+	return "", errors.New("oci: no tenancy in instance certificate")
+}
+
+func fingerprint(cert *x509.Certificate) string {
+	sum := sha1.Sum(cert.Raw)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+func (p *instancePrincipal) federate() error {
+	region, err := p.metadata("/instance/canonicalRegionName")
+	if err != nil {
+		return err
+	}
+	certPEM, err := p.metadata("/identity/cert.pem")
+	if err != nil {
+		return err
+	}
+	keyPEM, err := p.metadata("/identity/key.pem")
+	if err != nil {
+		return err
+	}
+	intermediatePEM, err := p.metadata("/identity/intermediate.pem")
+	if err != nil {
+		return err
+	}
+
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		return err
+	}
+	intermediate, err := parseCertificate(intermediatePEM)
+	if err != nil {
+		return err
+	}
+	instanceKey, err := parsePrivateKey(keyPEM, "")
+	if err != nil {
+		return err
+	}
+	tenancy, err := tenancyOf(cert)
+	if err != nil {
+		return err
+	}
+
+	sessionKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&sessionKey.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"certificate":              base64.StdEncoding.EncodeToString(cert.Raw),
+		"publicKey":                base64.StdEncoding.EncodeToString(publicKey),
+		"intermediateCertificates": []string{base64.StdEncoding.EncodeToString(intermediate.Raw)},
+		"purpose":                  "DEFAULT",
+	})
+	if err != nil {
+		return err
+	}
+
+	authURL := p.authURL
+	if authURL == "" {
+		authURL = fmt.Sprintf("https://auth.%s.oraclecloud.com/v1/x509", region)
+	}
+	req, err := http.NewRequest(http.MethodPost, authURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if err := signRequest(req, body, tenancy+"/fed-x509/"+fingerprint(cert), instanceKey, time.Now()); err != nil {
+		return err
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("oci: federation: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("oci: federation: %s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	var token struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return err
+	}
+
+	p.keyID = "ST$" + token.Token
+	p.key = sessionKey
+	p.regionName = string(region)
+	return nil
+}
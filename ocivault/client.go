@@ -0,0 +1,295 @@
+package ocivault
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+)
+
+// EnvAuth selects the authentication method, following the OCI CLI
+// convention. Set it to "instance_principal" to authenticate as the compute
+// instance; otherwise the API key of a config file profile is used.
+const EnvAuth = "OCI_CLI_AUTH"
+
+// keyProvider supplies the key and key ID used to sign requests.
+type keyProvider interface {
+	signingKey() (keyID string, key *rsa.PrivateKey, err error)
+	region() (string, error)
+}
+
+// Client implements SecretsClient on top of the OCI REST APIs.
+type Client struct {
+	HTTPClient *http.Client
+
+	keys keyProvider
+	// Endpoints of the secret retrieval and vault management APIs, derived
+	// from the region when empty.
+	secretsEndpoint string
+	vaultsEndpoint  string
+}
+
+// NewClientFromEnv creates a client authenticated with instance principals
+// when OCI_CLI_AUTH is "instance_principal", or with the config file profile
+// selected by OCI_CLI_CONFIG_FILE and OCI_CLI_PROFILE otherwise.
+func NewClientFromEnv() (*Client, error) {
+	if os.Getenv(EnvAuth) == "instance_principal" {
+		return &Client{keys: newInstancePrincipal()}, nil
+	}
+	keys, err := loadConfigProfile(os.Getenv(EnvConfigFile), os.Getenv(EnvProfile))
+	if err != nil {
+		return nil, err
+	}
+	return &Client{keys: keys}, nil
+}
+
+type serviceError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *serviceError) Error() string {
+	return fmt.Sprintf("oci: %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// DefaultTimeout is the timeout of requests made by a client without an
+// HTTPClient of its own.
+const DefaultTimeout = 30 * time.Second
+
+var defaultHTTPClient = &http.Client{Timeout: DefaultTimeout}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return defaultHTTPClient
+}
+
+func (c *Client) endpoints() (string, string, error) {
+	if c.secretsEndpoint != "" && c.vaultsEndpoint != "" {
+		return c.secretsEndpoint, c.vaultsEndpoint, nil
+	}
+	region, err := c.keys.region()
+	if err != nil {
+		return "", "", err
+	}
+	return fmt.Sprintf("https://secrets.vaults.%s.oci.oraclecloud.com/20190301", region),
+		fmt.Sprintf("https://vaults.%s.oci.oraclecloud.com/20180608", region), nil
+}
+
+// call sends a signed request and decodes the JSON response into out, if out
+// is not nil. It returns the response headers.
+func (c *Client) call(method, rawURL string, body, out interface{}) (http.Header, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(credentials.OperationContext(), method, rawURL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	keyID, key, err := c.keys.signingKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := signRequest(req, payload, keyID, key, time.Now()); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, credentials.ClassifyTransportError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, ErrNotFound
+		}
+		svcErr := &serviceError{}
+		b, _ := ioutil.ReadAll(resp.Body)
+		if json.Unmarshal(b, svcErr) != nil {
+			svcErr.Message = strings.TrimSpace(string(b))
+		}
+		svcErr.Status = resp.StatusCode
+		return nil, credentials.ClassifyHTTPStatus(resp.StatusCode, svcErr)
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return nil, err
+		}
+	}
+	return resp.Header, nil
+}
+
+// signRequest signs req following the OCI request signature scheme.
+func signRequest(req *http.Request, body []byte, keyID string, key *rsa.PrivateKey, now time.Time) error {
+	req.Header.Set("Date", now.UTC().Format(http.TimeFormat))
+	headers := []string{"date", "(request-target)", "host"}
+	if req.Method == http.MethodPost || req.Method == http.MethodPut {
+		sum := sha256.Sum256(body)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Length", fmt.Sprint(len(body)))
+		req.Header.Set("X-Content-Sha256", base64.StdEncoding.EncodeToString(sum[:]))
+		headers = append(headers, "content-length", "content-type", "x-content-sha256")
+	}
+
+	sum := sha256.Sum256([]byte(signingString(req, headers)))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf(`Signature version="1",headers=%q,keyId=%q,algorithm="rsa-sha256",signature=%q`,
+		strings.Join(headers, " "), keyID, base64.StdEncoding.EncodeToString(sig)))
+	return nil
+}
+
+func signingString(req *http.Request, headers []string) string {
+	lines := make([]string, 0, len(headers))
+	for _, h := range headers {
+		switch h {
+		case "(request-target)":
+			lines = append(lines, fmt.Sprintf("(request-target): %s %s", strings.ToLower(req.Method), req.URL.RequestURI()))
+		case "host":
+			lines = append(lines, "host: "+req.URL.Host)
+		default:
+			lines = append(lines, h+": "+req.Header.Get(h))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+type secretContent struct {
+	ContentType string `json:"contentType"`
+	Content     string `json:"content"`
+}
+
+func newSecretContent(content []byte) secretContent {
+	return secretContent{ContentType: "BASE64", Content: base64.StdEncoding.EncodeToString(content)}
+}
+
+// GetSecretBundleByName returns the content of the current version of a secret.
+func (c *Client) GetSecretBundleByName(vaultID, name string) ([]byte, error) {
+	secretsEndpoint, _, err := c.endpoints()
+	if err != nil {
+		return nil, err
+	}
+
+	q := url.Values{"secretName": {name}, "vaultId": {vaultID}}
+	var bundle struct {
+		SecretBundleContent secretContent `json:"secretBundleContent"`
+	}
+	if _, err := c.call(http.MethodPost, secretsEndpoint+"/secretbundles/actions/getByName?"+q.Encode(), nil, &bundle); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(bundle.SecretBundleContent.Content)
+}
+
+// ListSecrets returns the secrets of a vault, optionally filtered by name.
+func (c *Client) ListSecrets(compartmentID, vaultID, name string) ([]SecretSummary, error) {
+	_, vaultsEndpoint, err := c.endpoints()
+	if err != nil {
+		return nil, err
+	}
+
+	q := url.Values{"compartmentId": {compartmentID}, "vaultId": {vaultID}}
+	if name != "" {
+		q.Set("name", name)
+	}
+
+	var secrets []SecretSummary
+	for {
+		var page []struct {
+			ID             string            `json:"id"`
+			SecretName     string            `json:"secretName"`
+			LifecycleState string            `json:"lifecycleState"`
+			FreeformTags   map[string]string `json:"freeformTags"`
+		}
+		header, err := c.call(http.MethodGet, vaultsEndpoint+"/secrets?"+q.Encode(), nil, &page)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range page {
+			secrets = append(secrets, SecretSummary{ID: s.ID, Name: s.SecretName, LifecycleState: s.LifecycleState, FreeformTags: s.FreeformTags})
+		}
+		next := header.Get("Opc-Next-Page")
+		if next == "" {
+			return secrets, nil
+		}
+		q.Set("page", next)
+	}
+}
+
+// CreateSecret creates a new secret.
+func (c *Client) CreateSecret(compartmentID, vaultID, keyID, name string, content []byte, tags map[string]string) error {
+	_, vaultsEndpoint, err := c.endpoints()
+	if err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{
+		"compartmentId": compartmentID,
+		"vaultId":       vaultID,
+		"keyId":         keyID,
+		"secretName":    name,
+		"secretContent": newSecretContent(content),
+		"freeformTags":  tags,
+	}
+	_, err = c.call(http.MethodPost, vaultsEndpoint+"/secrets", body, nil)
+	return err
+}
+
+// UpdateSecret stores content as the new current version of a secret.
+func (c *Client) UpdateSecret(secretID string, content []byte) error {
+	_, vaultsEndpoint, err := c.endpoints()
+	if err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{"secretContent": newSecretContent(content)}
+	_, err = c.call(http.MethodPut, vaultsEndpoint+"/secrets/"+url.PathEscape(secretID), body, nil)
+	return err
+}
+
+// ScheduleSecretDeletion schedules a secret for deletion after the default
+// retention period of the vault.
+func (c *Client) ScheduleSecretDeletion(secretID string) error {
+	_, vaultsEndpoint, err := c.endpoints()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.call(http.MethodPost, vaultsEndpoint+"/secrets/"+url.PathEscape(secretID)+"/actions/scheduleDeletion", struct{}{}, nil)
+	return err
+}
+
+// CancelSecretDeletion cancels the pending deletion of a secret.
+func (c *Client) CancelSecretDeletion(secretID string) error {
+	_, vaultsEndpoint, err := c.endpoints()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.call(http.MethodPost, vaultsEndpoint+"/secrets/"+url.PathEscape(secretID)+"/actions/cancelDeletion", nil, nil)
+	return err
+}
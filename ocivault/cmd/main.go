@@ -0,0 +1,10 @@
+package main
+
+import (
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/docker/docker-credential-helpers/ocivault"
+)
+
+func main() {
+	credentials.Serve(ocivault.Vault{})
+}
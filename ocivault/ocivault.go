@@ -0,0 +1,308 @@
+// An Oracle Cloud Infrastructure (OCI) Vault based credential helper.
+// Credentials are stored as secrets in a single vault and compartment. Each
+// secret holds the JSON serialization of the credentials and is named after
+// the registry host of the server URL:
+//
+//	https://registry.example.com:5000/v2/ -> docker-registry.example.com_5000
+//
+// Every character outside of letters, digits, '.' and '-' is replaced with
+// '_', as by credentials.SanitizeHost. Helper-managed secrets carry the
+// freeform tag "docker-credential-helpers", whose value is the credentials
+// label, and only those secrets are listed.
+package ocivault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/docker/docker-credential-helpers/registryurl"
+)
+
+// Environment variables used to configure the helper when the matching Vault
+// fields are left empty.
+const (
+	EnvCompartmentID = "OCI_COMPARTMENT_ID"
+	EnvVaultID       = "OCI_VAULT_ID"
+	EnvKeyID         = "OCI_KEY_ID"
+)
+
+// TagKey is the freeform tag set on secrets managed by the helper.
+const TagKey = "docker-credential-helpers"
+
+// Secret lifecycle states used by the helper.
+const (
+	StateActive          = "ACTIVE"
+	StatePendingDeletion = "PENDING_DELETION"
+)
+
+// ErrNotFound is returned by a SecretsClient when the requested secret does
+// not exist.
+var ErrNotFound = errors.New("oci: secret not found")
+
+// SecretSummary describes a secret of the vault.
+type SecretSummary struct {
+	ID             string
+	Name           string
+	LifecycleState string
+	FreeformTags   map[string]string
+}
+
+// SecretsClient is the subset of the OCI Vault and Secrets APIs used by the
+// helper. Secret contents are passed unencoded; implementations take care of
+// the base64 encoding required by the API.
+type SecretsClient interface {
+	// GetSecretBundleByName returns the content of the current version of a
+	// secret, or ErrNotFound.
+	GetSecretBundleByName(vaultID, name string) ([]byte, error)
+	// ListSecrets returns the secrets of a vault, optionally filtered by name.
+	ListSecrets(compartmentID, vaultID, name string) ([]SecretSummary, error)
+	// CreateSecret creates a new secret.
+	CreateSecret(compartmentID, vaultID, keyID, name string, content []byte, tags map[string]string) error
+	// UpdateSecret stores content as the new current version of a secret.
+	UpdateSecret(secretID string, content []byte) error
+	// ScheduleSecretDeletion schedules a secret for deletion.
+	ScheduleSecretDeletion(secretID string) error
+	// CancelSecretDeletion cancels the pending deletion of a secret.
+	CancelSecretDeletion(secretID string) error
+}
+
+// Vault handles secrets using OCI Vault as a store. Empty fields fall back to
+// the OCI_* environment variables, and a nil Client is created from the
+// environment with NewClientFromEnv, so the zero value is ready to use from a
+// credential helper binary. The client created from the environment is shared
+// by all Vault values of the process.
+type Vault struct {
+	CompartmentID string
+	VaultID       string
+	// KeyID is the master encryption key used to create new secrets.
+	KeyID  string
+	Client SecretsClient
+}
+
+// clientMutex is held while creating envClient, so that the config file is
+// read, or the instance principal token fetched, only once per process.
+var clientMutex sync.Mutex
+var envClient SecretsClient
+
+// newEnvClient creates the shared client.
+var newEnvClient = func() (SecretsClient, error) {
+	return NewClientFromEnv()
+}
+
+func sharedClient() (SecretsClient, error) {
+	clientMutex.Lock()
+	defer clientMutex.Unlock()
+	if envClient == nil {
+		client, err := newEnvClient()
+		if err != nil {
+			return nil, err
+		}
+		envClient = client
+	}
+	return envClient, nil
+}
+
+func envDefault(value, name string) string {
+	if value != "" {
+		return value
+	}
+	return os.Getenv(name)
+}
+
+// config returns the resolved compartment and vault IDs, and client.
+func (v Vault) config() (string, string, SecretsClient, error) {
+	compartmentID := envDefault(v.CompartmentID, EnvCompartmentID)
+	if compartmentID == "" {
+		return "", "", nil, fmt.Errorf("oci: %s is not set", EnvCompartmentID)
+	}
+	vaultID := envDefault(v.VaultID, EnvVaultID)
+	if vaultID == "" {
+		return "", "", nil, fmt.Errorf("oci: %s is not set", EnvVaultID)
+	}
+	client := v.Client
+	if client == nil {
+		var err error
+		if client, err = sharedClient(); err != nil {
+			return "", "", nil, err
+		}
+	}
+	return compartmentID, vaultID, client, nil
+}
+
+// SecretName returns the name of the secret holding the credentials for a
+// server URL.
+func SecretName(serverURL string) (string, error) {
+	u, err := registryurl.Parse(serverURL)
+	if err != nil {
+		return "", err
+	}
+	return "docker-" + credentials.SanitizeHost(u.Host), nil
+}
+
+func isManaged(s SecretSummary) bool {
+	return s.FreeformTags[TagKey] == credentials.CredsLabel
+}
+
+// findSecret returns the managed secret with the given name, or nil.
+func findSecret(client SecretsClient, compartmentID, vaultID, name string) (*SecretSummary, error) {
+	secrets, err := client.ListSecrets(compartmentID, vaultID, name)
+	if err != nil {
+		return nil, err
+	}
+	for i := range secrets {
+		if secrets[i].Name == name && isManaged(secrets[i]) {
+			return &secrets[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func getCredentials(client SecretsClient, vaultID, name string) (*credentials.Credentials, error) {
+	content, err := client.GetSecretBundleByName(vaultID, name)
+	if err == ErrNotFound {
+		return nil, credentials.NewErrCredentialsNotFound()
+	}
+	if err != nil {
+		return nil, err
+	}
+	var creds credentials.Credentials
+	if err := json.Unmarshal(content, &creds); err != nil {
+		return nil, fmt.Errorf("oci: invalid credentials in secret %s: %v", name, err)
+	}
+	return &creds, nil
+}
+
+// Add adds new credentials to the vault, creating a new version of the
+// existing secret for the same registry host.
+func (v Vault) Add(creds *credentials.Credentials) error {
+	if creds == nil {
+		return errors.New("missing credentials")
+	}
+
+	name, err := SecretName(creds.ServerURL)
+	if err != nil {
+		return err
+	}
+	compartmentID, vaultID, client, err := v.config()
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+
+	existing, err := findSecret(client, compartmentID, vaultID, name)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		keyID := envDefault(v.KeyID, EnvKeyID)
+		if keyID == "" {
+			return fmt.Errorf("oci: %s is not set", EnvKeyID)
+		}
+		return client.CreateSecret(compartmentID, vaultID, keyID, name, content, map[string]string{TagKey: credentials.CredsLabel})
+	}
+
+	if existing.LifecycleState == StatePendingDeletion {
+		if err := client.CancelSecretDeletion(existing.ID); err != nil {
+			return err
+		}
+	}
+	return client.UpdateSecret(existing.ID, content)
+}
+
+// Delete schedules the secret holding the credentials for deletion.
+func (v Vault) Delete(serverURL string) error {
+	if serverURL == "" {
+		return errors.New("missing server url")
+	}
+
+	name, err := SecretName(serverURL)
+	if err != nil {
+		return err
+	}
+	compartmentID, vaultID, client, err := v.config()
+	if err != nil {
+		return err
+	}
+
+	existing, err := findSecret(client, compartmentID, vaultID, name)
+	if err != nil {
+		return err
+	}
+	if existing == nil || existing.LifecycleState != StateActive {
+		return credentials.NewErrCredentialsNotFound()
+	}
+	return client.ScheduleSecretDeletion(existing.ID)
+}
+
+// Get returns the username and secret to use for a given registry server URL.
+func (v Vault) Get(serverURL string) (string, string, error) {
+	if serverURL == "" {
+		return "", "", errors.New("missing server url")
+	}
+
+	name, err := SecretName(serverURL)
+	if err != nil {
+		return "", "", err
+	}
+	compartmentID, vaultID, client, err := v.config()
+	if err != nil {
+		return "", "", err
+	}
+
+	// The Secrets API returns the content of secrets pending deletion and of
+	// secrets which are not managed by the helper, which must not be served.
+	existing, err := findSecret(client, compartmentID, vaultID, name)
+	if err == ErrNotFound {
+		return "", "", credentials.NewErrCredentialsNotFound()
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if existing == nil || existing.LifecycleState != StateActive {
+		return "", "", credentials.NewErrCredentialsNotFound()
+	}
+
+	creds, err := getCredentials(client, vaultID, name)
+	if err != nil {
+		return "", "", err
+	}
+	return creds.Username, creds.Secret, nil
+}
+
+// List returns the stored URLs and corresponding usernames of the secrets
+// managed by the helper.
+func (v Vault) List() (map[string]string, error) {
+	compartmentID, vaultID, client, err := v.config()
+	if err != nil {
+		return nil, err
+	}
+
+	secrets, err := client.ListSecrets(compartmentID, vaultID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	resp := map[string]string{}
+	for _, s := range secrets {
+		if !isManaged(s) || s.LifecycleState != StateActive {
+			continue
+		}
+		creds, err := getCredentials(client, vaultID, s.Name)
+		if credentials.IsErrCredentialsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		resp[creds.ServerURL] = creds.Username
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,304 @@
+package ocivault
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+)
+
+// mockSecretsClient keeps the secrets of a single vault in memory. Like the
+// Secrets API, it returns the content of any secret by name, whatever its
+// lifecycle state and tags.
+type mockSecretsClient struct {
+	secrets  map[string]*SecretSummary
+	contents map[string][]byte
+}
+
+func newMockSecretsClient() *mockSecretsClient {
+	return &mockSecretsClient{secrets: map[string]*SecretSummary{}, contents: map[string][]byte{}}
+}
+
+func (m *mockSecretsClient) GetSecretBundleByName(vaultID, name string) ([]byte, error) {
+	for id, s := range m.secrets {
+		if s.Name == name {
+			return m.contents[id], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *mockSecretsClient) ListSecrets(compartmentID, vaultID, name string) ([]SecretSummary, error) {
+	var secrets []SecretSummary
+	for _, s := range m.secrets {
+		if name == "" || s.Name == name {
+			secrets = append(secrets, *s)
+		}
+	}
+	return secrets, nil
+}
+
+func (m *mockSecretsClient) CreateSecret(compartmentID, vaultID, keyID, name string, content []byte, tags map[string]string) error {
+	id := fmt.Sprintf("ocid1.vaultsecret.%d", len(m.secrets))
+	m.secrets[id] = &SecretSummary{ID: id, Name: name, LifecycleState: StateActive, FreeformTags: tags}
+	m.contents[id] = content
+	return nil
+}
+
+func (m *mockSecretsClient) UpdateSecret(secretID string, content []byte) error {
+	m.contents[secretID] = content
+	return nil
+}
+
+func (m *mockSecretsClient) ScheduleSecretDeletion(secretID string) error {
+	m.secrets[secretID].LifecycleState = StatePendingDeletion
+	return nil
+}
+
+func (m *mockSecretsClient) CancelSecretDeletion(secretID string) error {
+	m.secrets[secretID].LifecycleState = StateActive
+	return nil
+}
+
+func TestSecretName(t *testing.T) {
+	tests := []struct {
+		url  string
+		name string
+	}{
+		{url: "registry.example.com", name: "docker-registry.example.com"},
+		{url: "https://registry.example.com:5000/v2/", name: "docker-registry.example.com_5000"},
+		{url: "https://index.docker.io/v1/", name: "docker-index.docker.io"},
+	}
+	for _, te := range tests {
+		name, err := SecretName(te.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != te.name {
+			t.Errorf("expected secret name %q for %q, got %q", te.name, te.url, name)
+		}
+	}
+}
+
+func TestVaultHelper(t *testing.T) {
+	client := newMockSecretsClient()
+	// A secret not managed by the helper must never be listed.
+	client.CreateSecret("", "", "", "unrelated", []byte("{}"), nil)
+
+	helper := Vault{CompartmentID: "compartment", VaultID: "vault", KeyID: "key", Client: client}
+
+	creds := &credentials.Credentials{
+		ServerURL: "https://registry.example.com:5000/v2/",
+		Username:  "foo",
+		Secret:    "bar",
+	}
+	if err := helper.Add(creds); err != nil {
+		t.Fatal(err)
+	}
+	creds.Secret = "baz"
+	if err := helper.Add(creds); err != nil {
+		t.Fatal(err)
+	}
+
+	username, secret, err := helper.Get("registry.example.com:5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if username != "foo" || secret != "baz" {
+		t.Fatalf("unexpected credentials %s:%s", username, secret)
+	}
+
+	credsList, err := helper.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(credsList) != 1 || credsList[creds.ServerURL] != "foo" {
+		t.Fatalf("unexpected list result: %v", credsList)
+	}
+
+	if err := helper.Delete(creds.ServerURL); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := helper.Get(creds.ServerURL); !credentials.IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+	if err := helper.Delete(creds.ServerURL); !credentials.IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+
+	// Storing again restores the secret scheduled for deletion.
+	if err := helper.Add(creds); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.secrets) != 2 {
+		t.Fatalf("expected the deleted secret to be restored, got %d secrets", len(client.secrets))
+	}
+	if _, _, err := helper.Get(creds.ServerURL); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVaultHelperIgnoredSecrets(t *testing.T) {
+	client := newMockSecretsClient()
+	content := []byte(`{"Username":"foo","Secret":"bar"}`)
+	client.CreateSecret("", "", "", "docker-unmanaged.example.com", content, map[string]string{"owner": "someone-else"})
+	client.CreateSecret("", "", "", "docker-deleted.example.com", content, map[string]string{TagKey: credentials.CredsLabel})
+	for _, s := range client.secrets {
+		if s.Name == "docker-deleted.example.com" {
+			client.ScheduleSecretDeletion(s.ID)
+		}
+	}
+
+	helper := Vault{CompartmentID: "compartment", VaultID: "vault", KeyID: "key", Client: client}
+	for _, serverURL := range []string{"unmanaged.example.com", "deleted.example.com", "missing.example.com"} {
+		if _, _, err := helper.Get(serverURL); !credentials.IsErrCredentialsNotFound(err) {
+			t.Fatalf("%s: expected not found error, got %v", serverURL, err)
+		}
+	}
+}
+
+func TestVaultHelperMissingKey(t *testing.T) {
+	helper := Vault{CompartmentID: "compartment", VaultID: "vault", Client: newMockSecretsClient()}
+	err := helper.Add(&credentials.Credentials{ServerURL: "registry.example.com", Username: "foo", Secret: "bar"})
+	if err == nil || !strings.Contains(err.Error(), EnvKeyID) {
+		t.Fatalf("expected missing %s error, got %v", EnvKeyID, err)
+	}
+}
+
+func TestSignRequest(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := []byte(`{"secretName":"docker-registry.example.com"}`)
+	req, err := http.NewRequest(http.MethodPost, "https://vaults.us-phoenix-1.oci.oraclecloud.com/20180608/secrets?vaultId=v", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := signRequest(req, body, "tenancy/user/fingerprint", key, time.Unix(0, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	auth := req.Header.Get("Authorization")
+	matches := regexp.MustCompile(`headers="([^"]+)",keyId="([^"]+)",algorithm="rsa-sha256",signature="([^"]+)"`).FindStringSubmatch(auth)
+	if matches == nil {
+		t.Fatalf("unexpected Authorization header %q", auth)
+	}
+	if matches[1] != "date (request-target) host content-length content-type x-content-sha256" {
+		t.Fatalf("unexpected signed headers %q", matches[1])
+	}
+	if matches[2] != "tenancy/user/fingerprint" {
+		t.Fatalf("unexpected key ID %q", matches[2])
+	}
+
+	expected := strings.Join([]string{
+		"date: Thu, 01 Jan 1970 00:00:00 GMT",
+		"(request-target): post /20180608/secrets?vaultId=v",
+		"host: vaults.us-phoenix-1.oci.oraclecloud.com",
+		fmt.Sprintf("content-length: %d", len(body)),
+		"content-type: application/json",
+		"x-content-sha256: " + req.Header.Get("X-Content-Sha256"),
+	}, "\n")
+	if s := signingString(req, strings.Fields(matches[1])); s != expected {
+		t.Fatalf("unexpected signing string:\n%s", s)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(matches[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(expected))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, sum[:], sig); err != nil {
+		t.Fatalf("invalid signature: %v", err)
+	}
+}
+
+func TestClientNotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Signature ") {
+			t.Errorf("unsigned request to %s", r.URL)
+		}
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"code":"NotAuthorizedOrNotFound","message":"secret not found"}`)
+	}))
+	defer server.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &Client{
+		keys:            &configProfile{keyID: "tenancy/user/fingerprint", key: key},
+		secretsEndpoint: server.URL,
+		vaultsEndpoint:  server.URL,
+	}
+	helper := Vault{CompartmentID: "compartment", VaultID: "vault", Client: client}
+
+	if _, _, err := helper.Get("registry.example.com"); !credentials.IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	profiles := parseConfig([]byte(`
+[DEFAULT]
+tenancy=ocid1.tenancy.oc1..aaa
+region = us-ashburn-1
+
+# a comment
+[other]
+region=eu-frankfurt-1
+`))
+
+	if profiles["other"]["tenancy"] != "ocid1.tenancy.oc1..aaa" {
+		t.Fatalf("expected tenancy to be inherited from DEFAULT, got %q", profiles["other"]["tenancy"])
+	}
+	if profiles["other"]["region"] != "eu-frankfurt-1" {
+		t.Fatalf("expected region to be overridden, got %q", profiles["other"]["region"])
+	}
+	if profiles["DEFAULT"]["region"] != "us-ashburn-1" {
+		t.Fatalf("unexpected DEFAULT region %q", profiles["DEFAULT"]["region"])
+	}
+}
+
+func TestVaultHelperSharedClient(t *testing.T) {
+	client := newMockSecretsClient()
+	client.CreateSecret("", "", "", "docker-registry.example.com", []byte(`{"Username":"foo","Secret":"bar"}`), map[string]string{TagKey: credentials.CredsLabel})
+
+	clientMutex.Lock()
+	oldClient, oldNewEnvClient := envClient, newEnvClient
+	envClient = nil
+	created := 0
+	newEnvClient = func() (SecretsClient, error) {
+		created++
+		return client, nil
+	}
+	clientMutex.Unlock()
+	defer func() {
+		clientMutex.Lock()
+		envClient, newEnvClient = oldClient, oldNewEnvClient
+		clientMutex.Unlock()
+	}()
+
+	for i := 0; i < 3; i++ {
+		helper := Vault{CompartmentID: "compartment", VaultID: "vault"}
+		if _, _, err := helper.Get("registry.example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if created != 1 {
+		t.Fatalf("expected the client to be created once, got %d", created)
+	}
+}
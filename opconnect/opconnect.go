@@ -0,0 +1,503 @@
+// A 1Password Connect based credential helper. Credentials are stored as
+// LOGIN items in a single vault of a Connect server. Each item is titled with
+// the registry host (and port, if any) of the server URL, carries the
+// credentials label as a tag, and keeps the username and secret in the
+// USERNAME and PASSWORD fields. The metadata of the credentials, if any, is
+// kept in the fields of the docker-metadata section, labelled with their key.
+//
+// This helper talks to the Connect REST API directly and does not need the
+// `op` command line tool.
+package opconnect
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/docker/docker-credential-helpers/registryurl"
+)
+
+// Environment variables used to configure the helper when the matching
+// Connect fields are left empty.
+const (
+	EnvHost  = "OP_CONNECT_HOST"
+	EnvToken = "OP_CONNECT_TOKEN"
+	EnvVault = "OP_CONNECT_VAULT"
+	// EnvTimeout is the timeout of requests to the server, as a duration
+	// such as "10s". It defaults to DefaultTimeout.
+	EnvTimeout = "OP_CONNECT_TIMEOUT"
+)
+
+// DefaultTimeout is the timeout of requests to the server when EnvTimeout is
+// not set.
+const DefaultTimeout = 30 * time.Second
+
+// vaultIDPattern matches 1Password object identifiers, which lets a vault be
+// configured either by ID or by name.
+var vaultIDPattern = regexp.MustCompile(`^[a-z0-9]{26}$`)
+
+// Connect handles secrets using a 1Password Connect server as a store.
+// Empty fields fall back to the OP_CONNECT_* environment variables, so the
+// zero value is ready to use from a credential helper binary.
+type Connect struct {
+	// Host is the base URL of the Connect server.
+	Host string
+	// Token is the Connect access token.
+	Token string
+	// Vault is the ID or name of the vault holding the credentials.
+	Vault string
+	// Client is the HTTP client used to reach the server.
+	Client *http.Client
+}
+
+// metadataSection is the ID of the item section holding the metadata of the
+// credentials.
+const metadataSection = "docker-metadata"
+
+type section struct {
+	ID    string `json:"id"`
+	Label string `json:"label,omitempty"`
+}
+
+type field struct {
+	ID      string   `json:"id,omitempty"`
+	Section *section `json:"section,omitempty"`
+	Label   string   `json:"label,omitempty"`
+	Purpose string   `json:"purpose,omitempty"`
+	Type    string   `json:"type,omitempty"`
+	Value   string   `json:"value"`
+}
+
+type itemURL struct {
+	Href    string `json:"href"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type vaultRef struct {
+	ID string `json:"id"`
+}
+
+type item struct {
+	ID       string    `json:"id,omitempty"`
+	Title    string    `json:"title"`
+	Vault    vaultRef  `json:"vault"`
+	Category string    `json:"category"`
+	Tags     []string  `json:"tags,omitempty"`
+	URLs     []itemURL `json:"urls,omitempty"`
+	Sections []section `json:"sections,omitempty"`
+	Fields   []field   `json:"fields,omitempty"`
+}
+
+// apiError is the error document returned by the Connect server.
+type apiError struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("1password connect: %d: %s", e.Status, e.Message)
+}
+
+func isNotFound(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound
+}
+
+func (c Connect) host() string {
+	if c.Host != "" {
+		return c.Host
+	}
+	return os.Getenv(EnvHost)
+}
+
+func (c Connect) token() string {
+	if c.Token != "" {
+		return c.Token
+	}
+	return os.Getenv(EnvToken)
+}
+
+func (c Connect) vault() string {
+	if c.Vault != "" {
+		return c.Vault
+	}
+	return os.Getenv(EnvVault)
+}
+
+// clientMutex is held while creating sharedClient, the HTTP client used by
+// all Connect values without a Client of their own. Sharing it lets the
+// operations of a process reuse the connections to the server.
+var clientMutex sync.Mutex
+var sharedClient *http.Client
+
+// newHTTPClient creates the shared HTTP client.
+var newHTTPClient = func() (*http.Client, error) {
+	timeout := DefaultTimeout
+	if v := os.Getenv(EnvTimeout); v != "" {
+		var err error
+		if timeout, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("1password connect: invalid %s: %v", EnvTimeout, err)
+		}
+	}
+	return &http.Client{Timeout: timeout}, nil
+}
+
+func (c Connect) client() (*http.Client, error) {
+	if c.Client != nil {
+		return c.Client, nil
+	}
+
+	clientMutex.Lock()
+	defer clientMutex.Unlock()
+	if sharedClient == nil {
+		client, err := newHTTPClient()
+		if err != nil {
+			return nil, err
+		}
+		sharedClient = client
+	}
+	return sharedClient, nil
+}
+
+// do sends a request to the Connect API and decodes the JSON response into
+// out, if out is not nil.
+func (c Connect) do(method, path string, body, out interface{}) error {
+	host, token := c.host(), c.token()
+	if host == "" {
+		return fmt.Errorf("1password connect: %s is not set", EnvHost)
+	}
+	if token == "" {
+		return fmt.Errorf("1password connect: %s is not set", EnvToken)
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(credentials.OperationContext(), method, strings.TrimRight(host, "/")+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return credentials.ClassifyTransportError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &apiError{Status: resp.StatusCode}
+		b, _ := ioutil.ReadAll(resp.Body)
+		if json.Unmarshal(b, apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(b))
+		}
+		apiErr.Status = resp.StatusCode
+		return credentials.ClassifyHTTPStatus(resp.StatusCode, apiErr)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// vaultID returns the ID of the configured vault, looking it up by name when
+// it is not configured as an ID.
+func (c Connect) vaultID() (string, error) {
+	v := c.vault()
+	if v == "" {
+		return "", fmt.Errorf("1password connect: %s is not set", EnvVault)
+	}
+	if vaultIDPattern.MatchString(v) {
+		return v, nil
+	}
+
+	var vaults []vaultRef
+	if err := c.do(http.MethodGet, "/v1/vaults?filter="+url.QueryEscape(fmt.Sprintf("name eq %q", v)), nil, &vaults); err != nil {
+		return "", err
+	}
+	if len(vaults) == 0 {
+		return "", fmt.Errorf("1password connect: vault %q not found", v)
+	}
+	return vaults[0].ID, nil
+}
+
+// itemTitle derives the item title used for a server URL.
+func itemTitle(serverURL string) (string, error) {
+	u, err := registryurl.Parse(serverURL)
+	if err != nil {
+		return "", err
+	}
+	return u.Host, nil
+}
+
+func hasLabel(tags []string) bool {
+	for _, t := range tags {
+		if t == credentials.CredsLabel {
+			return true
+		}
+	}
+	return false
+}
+
+// findItem returns the labelled item with the given title, or nil if there is
+// none.
+func (c Connect) findItem(vaultID, title string) (*item, error) {
+	var items []item
+	path := fmt.Sprintf("/v1/vaults/%s/items?filter=%s", vaultID, url.QueryEscape(fmt.Sprintf("title eq %q", title)))
+	if err := c.do(http.MethodGet, path, nil, &items); err != nil {
+		return nil, err
+	}
+	for i := range items {
+		if items[i].Title == title && hasLabel(items[i].Tags) {
+			return c.getItem(vaultID, items[i].ID)
+		}
+	}
+	return nil, nil
+}
+
+func (c Connect) getItem(vaultID, itemID string) (*item, error) {
+	var it item
+	if err := c.do(http.MethodGet, fmt.Sprintf("/v1/vaults/%s/items/%s", vaultID, itemID), nil, &it); err != nil {
+		return nil, err
+	}
+	return &it, nil
+}
+
+// fieldValue returns the value of the field with the given purpose, falling
+// back to a field labelled after it.
+func (it *item) fieldValue(purpose string) string {
+	for _, f := range it.Fields {
+		if f.Purpose == purpose {
+			return f.Value
+		}
+	}
+	for _, f := range it.Fields {
+		if f.Section == nil && strings.EqualFold(f.Label, purpose) {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// metadata returns the fields of the metadata section, by label.
+func (it *item) metadata() map[string]string {
+	var meta map[string]string
+	for _, f := range it.Fields {
+		if f.Section == nil || f.Section.ID != metadataSection {
+			continue
+		}
+		if meta == nil {
+			meta = map[string]string{}
+		}
+		meta[f.Label] = f.Value
+	}
+	return meta
+}
+
+// serverURL returns the server URL recorded on the item.
+func (it *item) serverURL() string {
+	for _, u := range it.URLs {
+		if u.Primary {
+			return u.Href
+		}
+	}
+	if len(it.URLs) > 0 {
+		return it.URLs[0].Href
+	}
+	return it.Title
+}
+
+// Add adds new credentials to the vault, replacing the existing item for the
+// same registry host.
+func (c Connect) Add(creds *credentials.Credentials) error {
+	if creds == nil {
+		return errors.New("missing credentials")
+	}
+	return c.AddWithMeta(&credentials.ExtendedCredentials{Credentials: *creds})
+}
+
+// AddWithMeta adds new credentials and their metadata to the vault, replacing
+// the existing item for the same registry host.
+func (c Connect) AddWithMeta(creds *credentials.ExtendedCredentials) error {
+	if creds == nil {
+		return errors.New("missing credentials")
+	}
+
+	title, err := itemTitle(creds.ServerURL)
+	if err != nil {
+		return err
+	}
+	vaultID, err := c.vaultID()
+	if err != nil {
+		return err
+	}
+	existing, err := c.findItem(vaultID, title)
+	if err != nil {
+		return err
+	}
+
+	it := item{
+		Title:    title,
+		Vault:    vaultRef{ID: vaultID},
+		Category: "LOGIN",
+		Tags:     []string{credentials.CredsLabel},
+		URLs:     []itemURL{{Href: creds.ServerURL, Primary: true}},
+		Fields: []field{
+			{ID: "username", Label: "username", Purpose: "USERNAME", Type: "STRING", Value: creds.Username},
+			{ID: "password", Label: "password", Purpose: "PASSWORD", Type: "CONCEALED", Value: creds.Secret},
+		},
+	}
+	if len(creds.Metadata) > 0 {
+		meta := &section{ID: metadataSection, Label: "Docker metadata"}
+		it.Sections = []section{*meta}
+		keys := make([]string, 0, len(creds.Metadata))
+		for k := range creds.Metadata {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			it.Fields = append(it.Fields, field{Section: meta, Label: k, Type: "STRING", Value: creds.Metadata[k]})
+		}
+	}
+
+	if existing == nil {
+		return c.do(http.MethodPost, fmt.Sprintf("/v1/vaults/%s/items", vaultID), it, nil)
+	}
+	it.ID = existing.ID
+	return c.do(http.MethodPut, fmt.Sprintf("/v1/vaults/%s/items/%s", vaultID, it.ID), it, nil)
+}
+
+// Delete removes credentials from the vault.
+func (c Connect) Delete(serverURL string) error {
+	if serverURL == "" {
+		return errors.New("missing server url")
+	}
+
+	title, err := itemTitle(serverURL)
+	if err != nil {
+		return err
+	}
+	vaultID, err := c.vaultID()
+	if err != nil {
+		return err
+	}
+	it, err := c.findItem(vaultID, title)
+	if err != nil {
+		return err
+	}
+	if it == nil {
+		return credentials.NewErrCredentialsNotFound()
+	}
+
+	err = c.do(http.MethodDelete, fmt.Sprintf("/v1/vaults/%s/items/%s", vaultID, it.ID), nil, nil)
+	if isNotFound(err) {
+		return credentials.NewErrCredentialsNotFound()
+	}
+	return err
+}
+
+// Get returns the username and secret to use for a given registry server URL.
+func (c Connect) Get(serverURL string) (string, string, error) {
+	creds, err := c.GetWithMeta(serverURL)
+	if err != nil {
+		return "", "", err
+	}
+	return creds.Username, creds.Secret, nil
+}
+
+// GetWithMeta returns the credentials and their metadata for a given registry
+// server URL.
+func (c Connect) GetWithMeta(serverURL string) (*credentials.ExtendedCredentials, error) {
+	if serverURL == "" {
+		return nil, errors.New("missing server url")
+	}
+
+	title, err := itemTitle(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	vaultID, err := c.vaultID()
+	if err != nil {
+		return nil, err
+	}
+	it, err := c.findItem(vaultID, title)
+	if isNotFound(err) || (err == nil && it == nil) {
+		return nil, credentials.NewErrCredentialsNotFound()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &credentials.ExtendedCredentials{
+		Credentials: credentials.Credentials{
+			ServerURL: serverURL,
+			Username:  it.fieldValue("USERNAME"),
+			Secret:    it.fieldValue("PASSWORD"),
+		},
+		Metadata: it.metadata(),
+	}, nil
+}
+
+// List returns the stored URLs and corresponding usernames for the credentials label.
+func (c Connect) List() (map[string]string, error) {
+	vaultID, err := c.vaultID()
+	if err != nil {
+		return nil, err
+	}
+
+	var items []item
+	if err := c.do(http.MethodGet, fmt.Sprintf("/v1/vaults/%s/items", vaultID), nil, &items); err != nil {
+		return nil, err
+	}
+
+	resp := map[string]string{}
+	for _, summary := range items {
+		if !hasLabel(summary.Tags) {
+			continue
+		}
+		it, err := c.getItem(vaultID, summary.ID)
+		if err != nil {
+			return nil, err
+		}
+		resp[it.serverURL()] = it.fieldValue("USERNAME")
+	}
+
+	return resp, nil
+}
+
+// Check looks up the configured vault, which checks that the server is
+// reachable and that the token grants access to the vault.
+func (c Connect) Check() error {
+	vaultID, err := c.vaultID()
+	if err != nil {
+		return err
+	}
+	var v vaultRef
+	return c.do(http.MethodGet, "/v1/vaults/"+vaultID, nil, &v)
+}
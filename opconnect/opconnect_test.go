@@ -0,0 +1,349 @@
+package opconnect
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+)
+
+const testVaultID = "abcdefghijklmnopqrstuvwxyz"
+
+// fakeConnect is an in-memory stand-in for a 1Password Connect server.
+type fakeConnect struct {
+	mu     sync.Mutex
+	items  map[string]item
+	nextID int
+}
+
+func newFakeConnect() *fakeConnect {
+	return &fakeConnect{items: map[string]item{}}
+}
+
+func (f *fakeConnect) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer token" {
+		writeError(w, http.StatusUnauthorized, "invalid token")
+		return
+	}
+
+	if r.URL.Path == "/v1/vaults" {
+		json.NewEncoder(w).Encode([]vaultRef{{ID: testVaultID}})
+		return
+	}
+
+	if r.URL.Path == "/v1/vaults/"+testVaultID {
+		json.NewEncoder(w).Encode(vaultRef{ID: testVaultID})
+		return
+	}
+
+	prefix := "/v1/vaults/" + testVaultID + "/items"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		writeError(w, http.StatusNotFound, "vault not found")
+		return
+	}
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		var title string
+		fmt.Sscanf(r.URL.Query().Get("filter"), "title eq %q", &title)
+		items := []item{}
+		for _, it := range f.items {
+			if title == "" || it.Title == title {
+				items = append(items, item{ID: it.ID, Title: it.Title, Tags: it.Tags})
+			}
+		}
+		json.NewEncoder(w).Encode(items)
+	case id == "" && r.Method == http.MethodPost:
+		var it item
+		json.NewDecoder(r.Body).Decode(&it)
+		f.nextID++
+		it.ID = fmt.Sprintf("item%d", f.nextID)
+		f.items[it.ID] = it
+		json.NewEncoder(w).Encode(it)
+	case r.Method == http.MethodGet:
+		it, ok := f.items[id]
+		if !ok {
+			writeError(w, http.StatusNotFound, "item not found")
+			return
+		}
+		json.NewEncoder(w).Encode(it)
+	case r.Method == http.MethodPut:
+		var it item
+		json.NewDecoder(r.Body).Decode(&it)
+		f.items[id] = it
+		json.NewEncoder(w).Encode(it)
+	case r.Method == http.MethodDelete:
+		if _, ok := f.items[id]; !ok {
+			writeError(w, http.StatusNotFound, "item not found")
+			return
+		}
+		delete(f.items, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiError{Status: status, Message: message})
+}
+
+func TestConnectHelper(t *testing.T) {
+	server := httptest.NewServer(newFakeConnect())
+	defer server.Close()
+
+	helper := Connect{Host: server.URL, Token: "token", Vault: testVaultID}
+
+	creds := &credentials.Credentials{
+		ServerURL: "https://foobar.docker.io:2376/v1",
+		Username:  "nothing",
+		Secret:    "isthebestmeshuggahalbum",
+	}
+	if err := helper.Add(creds); err != nil {
+		t.Fatal(err)
+	}
+
+	creds.Secret = "updated"
+	if err := helper.Add(creds); err != nil {
+		t.Fatal(err)
+	}
+
+	username, secret, err := helper.Get("foobar.docker.io:2376")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if username != "nothing" {
+		t.Fatalf("expected username nothing, got %s", username)
+	}
+	if secret != "updated" {
+		t.Fatalf("expected secret updated, got %s", secret)
+	}
+
+	credsList, err := helper.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(credsList) != 1 || credsList[creds.ServerURL] != "nothing" {
+		t.Fatalf("unexpected list result: %v", credsList)
+	}
+
+	if err := helper.Delete(creds.ServerURL); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := helper.Get(creds.ServerURL); !credentials.IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+	if err := helper.Delete(creds.ServerURL); !credentials.IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestConnectHelperTrailingDot(t *testing.T) {
+	server := httptest.NewServer(newFakeConnect())
+	defer server.Close()
+
+	helper := Connect{Host: server.URL, Token: "token", Vault: testVaultID}
+
+	creds := &credentials.Credentials{
+		ServerURL: "https://registry.example.com./v2/",
+		Username:  "foo",
+		Secret:    "bar",
+	}
+	if err := helper.Add(creds); err != nil {
+		t.Fatal(err)
+	}
+
+	username, secret, err := helper.Get("https://registry.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if username != "foo" || secret != "bar" {
+		t.Fatalf("expected the trailing dot entry, got %s:%s", username, secret)
+	}
+
+	if err := helper.Delete("registry.example.com."); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := helper.Get("https://registry.example.com"); !credentials.IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestConnectHelperMetadata(t *testing.T) {
+	server := httptest.NewServer(newFakeConnect())
+	defer server.Close()
+
+	helper := Connect{Host: server.URL, Token: "token", Vault: testVaultID}
+
+	creds := &credentials.ExtendedCredentials{
+		Credentials: credentials.Credentials{
+			ServerURL: "https://registry.example.com",
+			Username:  "foo",
+			Secret:    "bar",
+		},
+		Metadata: map[string]string{"token_type": "pat", "password": "not the secret"},
+	}
+	if err := helper.AddWithMeta(creds); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := helper.GetWithMeta("registry.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Username != "foo" || c.Secret != "bar" {
+		t.Fatalf("expected foo:bar, got %s:%s", c.Username, c.Secret)
+	}
+	if len(c.Metadata) != 2 || c.Metadata["token_type"] != "pat" || c.Metadata["password"] != "not the secret" {
+		t.Fatalf("expected the metadata to round-trip, got %v", c.Metadata)
+	}
+
+	// Storing credentials without metadata replaces it.
+	if err := helper.Add(&creds.Credentials); err != nil {
+		t.Fatal(err)
+	}
+	if c, err = helper.GetWithMeta("registry.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Metadata != nil {
+		t.Fatalf("expected no metadata, got %v", c.Metadata)
+	}
+}
+
+func TestConnectHelperVaultByName(t *testing.T) {
+	server := httptest.NewServer(newFakeConnect())
+	defer server.Close()
+
+	helper := Connect{Host: server.URL, Token: "token", Vault: "Docker"}
+
+	creds := &credentials.Credentials{
+		ServerURL: "https://registry.example.com",
+		Username:  "foo",
+		Secret:    "bar",
+	}
+	if err := helper.Add(creds); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := helper.Get(creds.ServerURL); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnectHelperUnauthorized(t *testing.T) {
+	server := httptest.NewServer(newFakeConnect())
+	defer server.Close()
+
+	helper := Connect{Host: server.URL, Token: "wrong", Vault: testVaultID}
+
+	_, _, err := helper.Get("https://registry.example.com")
+	if err == nil || credentials.IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected an authorization error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "invalid token") {
+		t.Fatalf("expected the server message in the error, got %v", err)
+	}
+	if !errors.Is(err, credentials.ErrPermissionDenied) {
+		t.Fatalf("expected a permission denied error, got %v", err)
+	}
+}
+
+func TestConnectHelperUnavailable(t *testing.T) {
+	server := httptest.NewServer(newFakeConnect())
+	server.Close()
+
+	helper := Connect{Host: server.URL, Token: "token", Vault: testVaultID}
+	if _, _, err := helper.Get("https://registry.example.com"); !errors.Is(err, credentials.ErrBackendUnavailable) {
+		t.Fatalf("expected a backend unavailable error, got %v", err)
+	}
+}
+
+func TestConnectHelperCheck(t *testing.T) {
+	server := httptest.NewServer(newFakeConnect())
+	defer server.Close()
+
+	helper := Connect{Host: server.URL, Token: "token", Vault: testVaultID}
+	if err := credentials.Check(helper); err != nil {
+		t.Fatal(err)
+	}
+
+	helper.Token = "wrong"
+	if err := credentials.Check(helper); !errors.Is(err, credentials.ErrPermissionDenied) {
+		t.Fatalf("expected a permission denied error, got %v", err)
+	}
+
+	helper = Connect{Host: server.URL, Token: "token", Vault: "zyxwvutsrqponmlkjihgfedcba"}
+	if err := credentials.Check(helper); err == nil {
+		t.Fatal("expected a missing vault to fail the check")
+	}
+}
+
+func TestConnectHelperTimeout(t *testing.T) {
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer server.Close()
+	defer close(block)
+
+	helper := Connect{Host: server.URL, Token: "token", Vault: testVaultID, Client: &http.Client{Timeout: 10 * time.Millisecond}}
+	if _, _, err := helper.Get("https://registry.example.com"); !errors.Is(err, credentials.ErrTimeout) {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+}
+
+func TestConnectHelperMissingConfig(t *testing.T) {
+	helper := Connect{Host: "http://127.0.0.1:0", Token: "token"}
+	if _, err := helper.List(); err == nil || !strings.Contains(err.Error(), EnvVault) {
+		t.Fatalf("expected missing %s error, got %v", EnvVault, err)
+	}
+}
+
+func TestConnectHelperSharedClient(t *testing.T) {
+	server := httptest.NewServer(newFakeConnect())
+	defer server.Close()
+
+	clientMutex.Lock()
+	oldClient, oldNewHTTPClient := sharedClient, newHTTPClient
+	sharedClient = nil
+	created := 0
+	newHTTPClient = func() (*http.Client, error) {
+		created++
+		return server.Client(), nil
+	}
+	clientMutex.Unlock()
+	defer func() {
+		clientMutex.Lock()
+		sharedClient, newHTTPClient = oldClient, oldNewHTTPClient
+		clientMutex.Unlock()
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			helper := Connect{Host: server.URL, Token: "token", Vault: testVaultID}
+			if _, _, err := helper.Get("registry.example.com"); !credentials.IsErrCredentialsNotFound(err) {
+				t.Errorf("expected not found error, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if created != 1 {
+		t.Fatalf("expected the HTTP client to be created once, got %d", created)
+	}
+}
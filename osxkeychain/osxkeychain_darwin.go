@@ -32,7 +32,11 @@ var ErrInteractionNotAllowed = errors.New(`keychain cannot be accessed because t
 type Osxkeychain struct{}
 
 // Add adds new credentials to the keychain.
+// Anonymous credentials are refused with credentials.ErrAnonymousUnsupported.
 func (h Osxkeychain) Add(creds *credentials.Credentials) error {
+	if creds.IsAnonymous() {
+		return credentials.ErrAnonymousUnsupported
+	}
 	h.Delete(creds.ServerURL)
 
 	s, err := splitServer(creds.ServerURL)
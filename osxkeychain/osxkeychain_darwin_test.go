@@ -1,6 +1,7 @@
 package osxkeychain
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 
@@ -71,6 +72,11 @@ func TestOSXKeychainHelperRetrieveAliases(t *testing.T) {
 
 		// stored with path, retrieved without
 		{"https://foobar.docker.io:1234/one/two", "https://foobar.docker.io:1234"},
+
+		// stored with the absolute hostname, retrieved without the trailing
+		// dot, and the other way around
+		{"https://absolute.docker.io.", "https://absolute.docker.io"},
+		{"https://absolute.docker.io", "absolute.docker.io."},
 	}
 
 	helper := Osxkeychain{}
@@ -211,3 +217,11 @@ func TestMissingCredentials(t *testing.T) {
 		t.Fatalf("expected ErrCredentialsNotFound, got %v", err)
 	}
 }
+
+func TestAnonymousCredentials(t *testing.T) {
+	helper := Osxkeychain{}
+	err := helper.Add(&credentials.Credentials{ServerURL: "https://anonymous.docker.io/v1/"})
+	if !errors.Is(err, credentials.ErrAnonymousUnsupported) {
+		t.Fatalf("expected ErrAnonymousUnsupported, got %v", err)
+	}
+}
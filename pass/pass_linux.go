@@ -21,6 +21,27 @@ import (
 
 const PASS_FOLDER = "docker-credential-helpers"
 
+// anonymousName is the name of the entry holding anonymous credentials,
+// which have no username to name their entry after.
+const anonymousName = "<anonymous>"
+
+// entryName returns the name of the entry holding the secret of a username.
+func entryName(username string) string {
+	if username == "" {
+		return anonymousName
+	}
+	return username
+}
+
+// entryUsername returns the username of an entry of the password store.
+func entryUsername(entry os.FileInfo) string {
+	name := strings.TrimSuffix(entry.Name(), ".gpg")
+	if name == anonymousName {
+		return ""
+	}
+	return name
+}
+
 // Pass handles secrets using Linux secret-service as a store.
 type Pass struct{}
 
@@ -49,7 +70,7 @@ func (p Pass) checkInitialized() error {
 	// We just run a `pass ls`, if it fails then pass is not initialized.
 	_, err := p.runPassHelper("", "ls")
 	if err != nil {
-		return fmt.Errorf("pass not initialized: %v", err)
+		return credentials.NewBackendError(credentials.ErrNotInitialized, fmt.Errorf("pass not initialized: %v", err))
 	}
 	passInitialized = true
 	return nil
@@ -64,7 +85,7 @@ func (p Pass) runPass(stdinContent string, args ...string) (string, error) {
 
 func (p Pass) runPassHelper(stdinContent string, args ...string) (string, error) {
 	var stdout, stderr bytes.Buffer
-	cmd := exec.Command("pass", args...)
+	cmd := exec.CommandContext(credentials.OperationContext(), "pass", args...)
 	cmd.Stdin = strings.NewReader(stdinContent)
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
@@ -86,7 +107,7 @@ func (h Pass) Add(creds *credentials.Credentials) error {
 
 	encoded := base64.URLEncoding.EncodeToString([]byte(creds.ServerURL))
 
-	_, err := h.runPass(creds.Secret, "insert", "-f", "-m", path.Join(PASS_FOLDER, encoded, creds.Username))
+	_, err := h.runPass(creds.Secret, "insert", "-f", "-m", path.Join(PASS_FOLDER, encoded, entryName(creds.Username)))
 	return err
 }
 
@@ -137,7 +158,7 @@ func (h Pass) Get(serverURL string) (string, string, error) {
 
 	if _, err := os.Stat(path.Join(getPassDir(), PASS_FOLDER, encoded)); err != nil {
 		if os.IsNotExist(err) {
-			return "", "", nil
+			return "", "", credentials.NewErrCredentialsNotFound()
 		}
 
 		return "", "", err
@@ -152,8 +173,8 @@ func (h Pass) Get(serverURL string) (string, string, error) {
 		return "", "", fmt.Errorf("no usernames for %s", serverURL)
 	}
 
-	actual := strings.TrimSuffix(usernames[0].Name(), ".gpg")
-	secret, err := h.runPass("", "show", path.Join(PASS_FOLDER, encoded, actual))
+	actual := entryUsername(usernames[0])
+	secret, err := h.runPass("", "show", path.Join(PASS_FOLDER, encoded, entryName(actual)))
 	return actual, secret, err
 }
 
@@ -185,7 +206,7 @@ func (h Pass) List() (map[string]string, error) {
 			return nil, fmt.Errorf("no usernames for %s", serverURL)
 		}
 
-		resp[string(serverURL)] = strings.TrimSuffix(usernames[0].Name(), ".gpg")
+		resp[string(serverURL)] = entryUsername(usernames[0])
 	}
 
 	return resp, nil
@@ -1,6 +1,9 @@
 package pass
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -54,13 +57,8 @@ func TestPassHelper(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		username, _, err = helper.Get(server)
-		if err != nil {
-			t.Fatal(err)
-		}
-
-		if username != "" {
-			t.Fatalf("%s shouldn't exist any more", username)
+		if _, _, err := helper.Get(server); !credentials.IsErrCredentialsNotFound(err) {
+			t.Fatalf("expected %s not to exist any more, got %v", server, err)
 		}
 	}
 
@@ -73,3 +71,77 @@ func TestPassHelper(t *testing.T) {
 		t.Fatal("didn't delete all creds?")
 	}
 }
+
+// fakePass emulates the pass commands used by the helper, keeping the
+// entries unencrypted in PASSWORD_STORE_DIR.
+const fakePass = `#!/bin/sh
+case "$1" in
+ls) exit 0 ;;
+insert) mkdir -p "$(dirname "$PASSWORD_STORE_DIR/$4")" && cat > "$PASSWORD_STORE_DIR/$4.gpg" ;;
+show)
+	[ -f "$PASSWORD_STORE_DIR/$2.gpg" ] || { echo "Error: $2 is not in the password store." >&2; exit 1; }
+	cat "$PASSWORD_STORE_DIR/$2.gpg" ;;
+rm) rm -rf "$PASSWORD_STORE_DIR/$3" ;;
+esac
+`
+
+// withFakePass runs the helper against fakePass in a temporary store.
+func withFakePass(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "pass"), []byte(fakePass), 0700); err != nil {
+		t.Fatal(err)
+	}
+	path, storeDir := os.Getenv("PATH"), os.Getenv("PASSWORD_STORE_DIR")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	os.Setenv("PASSWORD_STORE_DIR", filepath.Join(dir, "store"))
+	return func() {
+		os.Setenv("PATH", path)
+		os.Setenv("PASSWORD_STORE_DIR", storeDir)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestPassHelperAnonymous(t *testing.T) {
+	defer withFakePass(t)()
+	helper := Pass{}
+
+	if _, _, err := helper.Get("https://registry.example.com"); !credentials.IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected not found for missing credentials, got %v", err)
+	}
+
+	if err := helper.Add(&credentials.Credentials{ServerURL: "https://registry.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := helper.Add(&credentials.Credentials{ServerURL: "https://quay.io", Username: "foo", Secret: "bar"}); err != nil {
+		t.Fatal(err)
+	}
+
+	credsList, err := helper.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(credsList) != 2 || credsList["https://registry.example.com"] != "" || credsList["https://quay.io"] != "foo" {
+		t.Fatalf("unexpected list result: %v", credsList)
+	}
+
+	username, secret, err := helper.Get("https://registry.example.com")
+	if err != nil {
+		t.Fatalf("expected the anonymous credentials to be found, got %v", err)
+	}
+	if username != "" || secret != "" {
+		t.Fatalf("expected empty credentials, got %s/%s", username, secret)
+	}
+	if username, secret, err := helper.Get("https://quay.io"); err != nil || username != "foo" || secret != "bar" {
+		t.Fatalf("expected foo/bar, got %s/%s, %v", username, secret, err)
+	}
+
+	if err := helper.Delete("https://registry.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := helper.Get("https://registry.example.com"); !credentials.IsErrCredentialsNotFound(err) {
+		t.Fatalf("expected not found after delete, got %v", err)
+	}
+}
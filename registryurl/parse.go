@@ -13,6 +13,11 @@ import (
 // If serverURL does not have a valid scheme, `//` is used as scheme
 // before parsing. This prevents the hostname being used as path,
 // and the credentials being stored without host.
+//
+// A single trailing dot is removed from the hostname, so that the absolute
+// form of a domain name, such as `registry.example.com.`, designates the same
+// registry as `registry.example.com`. Hostnames ending with several dots hold
+// an empty label, which is not a valid domain name, and are rejected.
 func Parse(registryURL string) (*url.URL, error) {
 	// Check if registryURL has a scheme, otherwise add `//` as scheme.
 	if !strings.Contains(registryURL, "://") && !strings.HasPrefix(registryURL, "//") {
@@ -28,6 +33,17 @@ func Parse(registryURL string) (*url.URL, error) {
 		return nil, errors.New("unsupported scheme: " + u.Scheme)
 	}
 
+	if strings.HasSuffix(GetHostname(u), "..") {
+		return nil, errors.New("invalid hostname in URL")
+	}
+	if hostname := GetHostname(u); strings.HasSuffix(hostname, ".") {
+		port := GetPort(u)
+		u.Host = strings.TrimSuffix(hostname, ".")
+		if port != "" {
+			u.Host += ":" + port
+		}
+	}
+
 	if GetHostname(u) == "" {
 		return nil, errors.New("no hostname in URL")
 	}
@@ -20,6 +20,13 @@ func TestHelperParseURL(t *testing.T) {
 		{url: "https://foobar.docker.io:2376", expectedURL: "https://foobar.docker.io:2376"},
 		{url: "https://foobar.docker.io:2376/some/path", expectedURL: "https://foobar.docker.io:2376/some/path"},
 		{url: "https://foobar.docker.io:2376/some/other/path?foo=bar", expectedURL: "https://foobar.docker.io:2376/some/other/path"},
+		{url: "foobar.docker.io.", expectedURL: "//foobar.docker.io"},
+		{url: "https://foobar.docker.io.:2376/some/path", expectedURL: "https://foobar.docker.io:2376/some/path"},
+		// Stripping one dot would leave another absolute form, and stripping
+		// all of them would accept an empty label, which no resolver does.
+		{url: "https://foobar.docker.io../", err: errors.New("invalid hostname in URL")},
+		{url: "foobar.docker.io...:2376", err: errors.New("invalid hostname in URL")},
+		{url: "https://.", err: errors.New("no hostname in URL")},
 		{url: "/foobar.docker.io", err: errors.New("no hostname in URL")},
 		{url: "ftp://foobar.docker.io:2376", err: errors.New("unsupported scheme: ftp")},
 	}
@@ -18,10 +18,14 @@ import (
 type Secretservice struct{}
 
 // Add adds new credentials to the keychain.
+// Anonymous credentials are refused with credentials.ErrAnonymousUnsupported.
 func (h Secretservice) Add(creds *credentials.Credentials) error {
 	if creds == nil {
 		return errors.New("missing credentials")
 	}
+	if creds.IsAnonymous() {
+		return credentials.ErrAnonymousUnsupported
+	}
 	credsLabel := C.CString(credentials.CredsLabel)
 	defer C.free(unsafe.Pointer(credsLabel))
 	server := C.CString(creds.ServerURL)
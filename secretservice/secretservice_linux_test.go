@@ -1,6 +1,7 @@
 package secretservice
 
 import (
+	"errors"
 	"strings"
 	"testing"
 
@@ -88,3 +89,11 @@ func TestMissingCredentials(t *testing.T) {
 		t.Fatalf("expected ErrCredentialsNotFound, got %v", err)
 	}
 }
+
+func TestAnonymousCredentials(t *testing.T) {
+	helper := Secretservice{}
+	err := helper.Add(&credentials.Credentials{ServerURL: "https://anonymous.docker.io/v1/"})
+	if !errors.Is(err, credentials.ErrAnonymousUnsupported) {
+		t.Fatalf("expected ErrAnonymousUnsupported, got %v", err)
+	}
+}
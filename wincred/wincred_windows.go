@@ -14,7 +14,11 @@ import (
 type Wincred struct{}
 
 // Add adds new credentials to the windows credentials manager.
+// Anonymous credentials are refused with credentials.ErrAnonymousUnsupported.
 func (h Wincred) Add(creds *credentials.Credentials) error {
+	if creds.IsAnonymous() {
+		return credentials.ErrAnonymousUnsupported
+	}
 	credsLabels := []byte(credentials.CredsLabel)
 	g := winc.NewGenericCredential(creds.ServerURL)
 	g.UserName = creds.Username
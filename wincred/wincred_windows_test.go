@@ -1,6 +1,7 @@
 package wincred
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
@@ -102,6 +103,11 @@ func TestWinCredHelperRetrieveAliases(t *testing.T) {
 
 		// stored with path, retrieved without
 		{"https://foobar.docker.io/one/two", "https://foobar.docker.io"},
+
+		// stored with the absolute hostname, retrieved without the trailing
+		// dot, and the other way around
+		{"https://absolute.docker.io.", "https://absolute.docker.io"},
+		{"https://absolute.docker.io", "absolute.docker.io."},
 	}
 
 	helper := Wincred{}
@@ -242,3 +248,11 @@ func TestMissingCredentials(t *testing.T) {
 		t.Fatalf("expected ErrCredentialsNotFound, got %v", err)
 	}
 }
+
+func TestAnonymousCredentials(t *testing.T) {
+	helper := Wincred{}
+	err := helper.Add(&credentials.Credentials{ServerURL: "https://anonymous.docker.io/v1/"})
+	if !errors.Is(err, credentials.ErrAnonymousUnsupported) {
+		t.Fatalf("expected ErrAnonymousUnsupported, got %v", err)
+	}
+}